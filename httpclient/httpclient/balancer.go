@@ -0,0 +1,393 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EndpointState describes an endpoint as seen by a BalanceStrategy
+type EndpointState struct {
+	URL         string
+	Index       int // position in the list given to WithEndpoints
+	Outstanding int // requests whose response body is still open
+	Healthy     bool
+}
+
+// BalanceStrategy chooses the endpoint for an attempt
+type BalanceStrategy interface {
+	// Pick returns the index in candidates of the endpoint to use; candidates is never empty
+	Pick(candidates []EndpointState) int
+}
+
+// RoundRobin cycles through the endpoints
+func RoundRobin() BalanceStrategy {
+	return &roundRobin{}
+}
+
+// roundRobin implements RoundRobin
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+// Pick returns the next candidate in turn
+func (s *roundRobin) Pick(candidates []EndpointState) int {
+	return int((s.next.Add(1) - 1) % uint64(len(candidates)))
+}
+
+// LeastOutstanding picks the endpoint with the fewest requests in flight, rotating between ties
+func LeastOutstanding() BalanceStrategy {
+	return &leastOutstanding{}
+}
+
+// leastOutstanding implements LeastOutstanding
+type leastOutstanding struct {
+	next atomic.Uint64
+}
+
+// Pick returns the least loaded candidate
+func (s *leastOutstanding) Pick(candidates []EndpointState) int {
+	offset := int(s.next.Add(1) % uint64(len(candidates)))
+	best := offset
+	for i := range candidates {
+		j := (offset + i) % len(candidates)
+		if candidates[j].Outstanding < candidates[best].Outstanding {
+			best = j
+		}
+	}
+	return best
+}
+
+// Weighted spreads requests in proportion to the weights, given in the order of the
+// endpoints passed to WithEndpoints. Missing or non-positive weights count as 1
+func Weighted(weights ...int) BalanceStrategy {
+	return &weighted{weights: weights, current: make(map[int]int)}
+}
+
+// weighted implements smooth weighted round-robin
+type weighted struct {
+	weights []int
+	mu      sync.Mutex
+	current map[int]int
+}
+
+// Pick returns the candidate with the highest current weight
+func (s *weighted) Pick(candidates []EndpointState) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best, total := 0, 0
+	for i, cand := range candidates {
+		w := 1
+		if cand.Index < len(s.weights) && s.weights[cand.Index] > 0 {
+			w = s.weights[cand.Index]
+		}
+		total += w
+		s.current[cand.Index] += w
+		if s.current[cand.Index] > s.current[candidates[best].Index] {
+			best = i
+		}
+	}
+	s.current[candidates[best].Index] -= total
+	return best
+}
+
+// WithEndpoints spreads requests over several base URLs using strategy (RoundRobin if nil).
+// Relative URLs are resolved as with WithBaseURL, and every attempt, including retries,
+// goes to an endpoint not yet tried for the request while one is available. Endpoints
+// must not have a query or fragment and cannot be combined with WithBaseURL
+func WithEndpoints(endpoints []string, strategy BalanceStrategy) ClientOption {
+	return func(c *Client) error {
+		if len(endpoints) == 0 {
+			return errors.New("no endpoints given")
+		}
+		if strategy == nil {
+			strategy = RoundRobin()
+		}
+		b := c.balancer()
+		b.strategy = strategy
+		b.list = nil
+		for i, raw := range endpoints {
+			u, err := url.Parse(raw)
+			switch {
+			case err != nil:
+				return fmt.Errorf("invalid endpoint: %w", err)
+			case (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+				return fmt.Errorf("invalid endpoint %q: must be an absolute http or https URL", raw)
+			case u.RawQuery != "" || u.Fragment != "":
+				return fmt.Errorf("invalid endpoint %q: must not have a query or fragment", raw)
+			}
+			b.list = append(b.list, &endpoint{index: i, raw: raw, base: u})
+		}
+		return nil
+	}
+}
+
+// WithEjection ejects an endpoint for cooldown after the given number of consecutive
+// failures (defaults 5 and 30s). Failures are judged as for the circuit breaker
+func WithEjection(failures int, cooldown time.Duration) ClientOption {
+	return func(c *Client) error {
+		b := c.balancer()
+		b.failureThreshold = failures
+		b.cooldown = cooldown
+		return nil
+	}
+}
+
+// WithHealthCheck probes path on every endpoint at the given interval and takes endpoints
+// that do not answer with a 2xx status out of rotation until they do. Close stops the probes
+func WithHealthCheck(path string, interval time.Duration) ClientOption {
+	return func(c *Client) error {
+		if interval <= 0 {
+			return fmt.Errorf("health check interval must be positive, got %v", interval)
+		}
+		b := c.balancer()
+		b.healthPath = path
+		b.healthInterval = interval
+		return nil
+	}
+}
+
+// Endpoints returns the current state of the endpoints set with WithEndpoints
+func (c *Client) Endpoints() []EndpointState {
+	if c.endpoints == nil {
+		return nil
+	}
+	c.endpoints.mu.Lock()
+	defer c.endpoints.mu.Unlock()
+	states := make([]EndpointState, len(c.endpoints.list))
+	for i, ep := range c.endpoints.list {
+		states[i] = ep.state(time.Now())
+	}
+	return states
+}
+
+// balancer returns the client's endpoints, creating them on first use
+func (c *Client) balancer() *endpoints {
+	if c.endpoints == nil {
+		c.endpoints = &endpoints{failureThreshold: 5, cooldown: 30 * time.Second, stop: make(chan struct{})}
+	}
+	return c.endpoints
+}
+
+// endpoints holds the balanced endpoints and their health
+type endpoints struct {
+	strategy         BalanceStrategy
+	failureThreshold int
+	cooldown         time.Duration
+	healthPath       string
+	healthInterval   time.Duration
+	stop             chan struct{}
+	once             sync.Once
+
+	mu   sync.Mutex
+	list []*endpoint
+}
+
+// endpoint is one base URL and its health
+type endpoint struct {
+	index        int
+	raw          string
+	base         *url.URL
+	outstanding  int
+	failures     int
+	ejectedUntil time.Time
+	unhealthy    bool
+}
+
+// state returns the endpoint as seen by strategies
+func (ep *endpoint) state(now time.Time) EndpointState {
+	return EndpointState{
+		URL:         ep.raw,
+		Index:       ep.index,
+		Outstanding: ep.outstanding,
+		Healthy:     !ep.unhealthy && !now.Before(ep.ejectedUntil),
+	}
+}
+
+// route moves req onto the endpoint chosen for this attempt, preferring healthy endpoints
+// not in tried and without an open circuit breaker. Requests not addressed to one of the
+// endpoints are returned unchanged with a nil endpoint
+func (e *endpoints) route(req *http.Request, tried map[int]bool, breakers *circuitBreakers) (*http.Request, *endpoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var origin *endpoint
+	for _, ep := range e.list {
+		if _, ok := rebase(req.URL, ep.base, ep.base); ok {
+			origin = ep
+			break
+		}
+	}
+	if origin == nil {
+		return req, nil
+	}
+
+	now := time.Now()
+	var healthy, fresh []EndpointState
+	for _, ep := range e.list {
+		s := ep.state(now)
+		if !s.Healthy || (breakers != nil && breakers.isOpen(ep.base.Host)) {
+			continue
+		}
+		healthy = append(healthy, s)
+		if !tried[ep.index] {
+			fresh = append(fresh, s)
+		}
+	}
+	candidates := fresh
+	if len(candidates) == 0 {
+		candidates = healthy
+	}
+	if len(candidates) == 0 {
+		// Every endpoint is out of rotation; spread the load rather than fail outright
+		for _, ep := range e.list {
+			candidates = append(candidates, ep.state(now))
+		}
+	}
+	i := e.strategy.Pick(candidates)
+	if i < 0 || i >= len(candidates) {
+		i = 0
+	}
+	ep := e.list[candidates[i].Index]
+	ep.outstanding++
+
+	u, _ := rebase(req.URL, origin.base, ep.base)
+	out := req.Clone(req.Context())
+	out.URL = u
+	out.Host = ""
+	return out, ep
+}
+
+// release marks a request to ep as finished
+func (e *endpoints) release(ep *endpoint) {
+	e.mu.Lock()
+	ep.outstanding--
+	e.mu.Unlock()
+}
+
+// record counts consecutive failures of ep, reporting whether it was just ejected
+func (e *endpoints) record(ep *endpoint, resp *http.Response, err error) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !isBreakerFailure(resp, err) {
+		ep.failures = 0
+		return false
+	}
+	ep.failures++
+	if e.failureThreshold <= 0 || ep.failures < e.failureThreshold {
+		return false
+	}
+	ep.failures = 0
+	ep.ejectedUntil = time.Now().Add(e.cooldown)
+	return true
+}
+
+// setHealth records a probe result, reporting whether the health changed
+func (e *endpoints) setHealth(ep *endpoint, healthy bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	changed := ep.unhealthy == healthy
+	ep.unhealthy = !healthy
+	if healthy {
+		ep.failures = 0
+		ep.ejectedUntil = time.Time{}
+	}
+	return changed
+}
+
+// close stops the health probes
+func (e *endpoints) close() {
+	e.once.Do(func() { close(e.stop) })
+}
+
+// routeAttempt moves an attempt onto an endpoint, returning a func that marks
+// the endpoint's request as finished
+func (c *Client) routeAttempt(req *http.Request, tried map[int]bool) (*http.Request, *endpoint, func()) {
+	if c.endpoints == nil {
+		return req, nil, func() {}
+	}
+	req, ep := c.endpoints.route(req, tried, c.breakers)
+	if ep == nil {
+		return req, nil, func() {}
+	}
+	tried[ep.index] = true
+	var once sync.Once
+	return req, ep, func() {
+		once.Do(func() { c.endpoints.release(ep) })
+	}
+}
+
+// recordEndpoint counts the outcome of an attempt against its endpoint
+func (c *Client) recordEndpoint(ep *endpoint, resp *http.Response, err error) {
+	if ep != nil && c.endpoints.record(ep, resp, err) {
+		c.logger.Warn("ejected endpoint after consecutive failures", "endpoint", RedactURL(ep.base), "cooldown", c.endpoints.cooldown)
+	}
+}
+
+// probeEndpoints runs the active health checks until the client is closed
+func (c *Client) probeEndpoints() {
+	e := c.endpoints
+	ticker := time.NewTicker(e.healthInterval)
+	defer ticker.Stop()
+	for {
+		for _, ep := range e.list {
+			healthy := c.probe(ep)
+			if e.setHealth(ep, healthy) {
+				c.logger.Info("endpoint health changed", "endpoint", RedactURL(ep.base), "healthy", healthy)
+			}
+		}
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe reports whether the endpoint's health check answers with a 2xx status
+func (c *Client) probe(ep *endpoint) bool {
+	target, err := resolveURL(ep.raw, c.endpoints.healthPath)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.endpoints.healthInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return !NonSuccess(resp.StatusCode)
+}
+
+// rebase moves u from the endpoint at base from to the endpoint at base to, reporting
+// whether u was under from at all
+func rebase(u, from, to *url.URL) (*url.URL, bool) {
+	fromPath := strings.TrimSuffix(from.EscapedPath(), "/")
+	path := u.EscapedPath()
+	if u.Scheme != from.Scheme || u.Host != from.Host || !strings.HasPrefix(path, fromPath) {
+		return nil, false
+	}
+	rest := path[len(fromPath):]
+	if rest != "" && !strings.HasPrefix(rest, "/") {
+		return nil, false
+	}
+	escaped := strings.TrimSuffix(to.EscapedPath(), "/") + rest
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return nil, false
+	}
+	out := *u
+	out.Scheme, out.Host, out.User = to.Scheme, to.Host, to.User
+	out.Path, out.RawPath = unescaped, escaped
+	return &out, true
+}
@@ -0,0 +1,215 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// backend is a test server that counts requests other than health checks and can be switched to failing
+type backend struct {
+	*httptest.Server
+	hits atomic.Int32
+	down atomic.Bool
+}
+
+// newBackend starts a backend answering with its name and the request path
+func newBackend(t *testing.T, name string) *backend {
+	t.Helper()
+	b := &backend{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			b.hits.Add(1)
+		}
+		if b.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "%s %s", name, r.URL.RequestURI())
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// get requests url and returns the status and body
+func get(t *testing.T, c *Client, url string, opts ...RequestOption) (int, string) {
+	t.Helper()
+	resp, err := c.Get(url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, readAll(t, resp)
+}
+
+func TestEndpointsRoundRobin(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	c, err := NewClient(WithEndpoints([]string{a.URL + "/api", b.URL + "/v2/"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a /api/users/1?q=1", "b /v2/users/1?q=1", "a /api/users/1?q=1"}
+	for _, w := range want {
+		if _, body := get(t, c, "/users/1", WithQueryParam("q", "1")); body != w {
+			t.Errorf("body = %q, want %q", body, w)
+		}
+	}
+}
+
+func TestEndpointsFailoverAndEjection(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	b.down.Store(true)
+	c, err := NewClient(WithEndpoints([]string{a.URL, b.URL}, nil), WithRetry(3, time.Millisecond), WithEjection(2, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 6 {
+		if status, _ := get(t, c, "/x"); status != http.StatusOK {
+			t.Fatalf("status = %d, want the retry to move to the healthy endpoint", status)
+		}
+	}
+	if got := b.hits.Load(); got != 2 {
+		t.Errorf("failing endpoint got %d requests, want 2 before ejection", got)
+	}
+	states := c.Endpoints()
+	if !states[0].Healthy || states[1].Healthy {
+		t.Errorf("states = %+v, want the second endpoint ejected", states)
+	}
+}
+
+func TestEndpointsAllEjected(t *testing.T) {
+	a := newBackend(t, "a")
+	a.down.Store(true)
+	c, err := NewClient(WithEndpoints([]string{a.URL}, nil), WithRetry(0, 0), WithEjection(1, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get(t, c, "/x")
+	a.down.Store(false)
+	if status, _ := get(t, c, "/x"); status != http.StatusOK {
+		t.Errorf("status = %d, want requests to continue when every endpoint is ejected", status)
+	}
+}
+
+func TestEndpointsWeighted(t *testing.T) {
+	a, b, c := newBackend(t, "a"), newBackend(t, "b"), newBackend(t, "c")
+	client, err := NewClient(WithEndpoints([]string{a.URL, b.URL, c.URL}, Weighted(3, 1, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		get(t, client, "/x")
+	}
+	if a.hits.Load() != 6 || b.hits.Load() != 2 || c.hits.Load() != 2 {
+		t.Errorf("hits = %d/%d/%d, want 6/2/2", a.hits.Load(), b.hits.Load(), c.hits.Load())
+	}
+}
+
+func TestEndpointsLeastOutstanding(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	c, err := NewClient(WithEndpoints([]string{a.URL, b.URL}, LeastOutstanding()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.Get("/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		get(t, c, "/y")
+	}
+	busy := 0
+	for _, s := range c.Endpoints() {
+		busy += s.Outstanding
+	}
+	if busy != 1 {
+		t.Errorf("outstanding = %d, want only the open body counted", busy)
+	}
+	if a.hits.Load()+b.hits.Load() != 4 || min(a.hits.Load(), b.hits.Load()) != 1 {
+		t.Errorf("hits = %d/%d, want the idle endpoint to take the later requests", a.hits.Load(), b.hits.Load())
+	}
+	first.Body.Close()
+	first.Body.Close()
+	for _, s := range c.Endpoints() {
+		if s.Outstanding != 0 {
+			t.Errorf("outstanding = %d after close", s.Outstanding)
+		}
+	}
+}
+
+func TestEndpointsHealthCheck(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	b.down.Store(true)
+	c, err := NewClient(WithEndpoints([]string{a.URL, b.URL}, nil), WithHealthCheck("/health", 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	waitFor := func(healthy bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for c.Endpoints()[1].Healthy != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("endpoint health did not become %v", healthy)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor(false)
+	for range 4 {
+		get(t, c, "/x")
+	}
+	if b.hits.Load() != 0 {
+		t.Errorf("unhealthy endpoint received %d requests", b.hits.Load())
+	}
+	b.down.Store(false)
+	waitFor(true)
+}
+
+func TestEndpointsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{"empty", []ClientOption{WithEndpoints(nil, nil)}},
+		{"relative", []ClientOption{WithEndpoints([]string{"api.test"}, nil)}},
+		{"query", []ClientOption{WithEndpoints([]string{"https://api.test?x=1"}, nil)}},
+		{"with base URL", []ClientOption{WithBaseURL("https://api.test"), WithEndpoints([]string{"https://api.test"}, nil)}},
+		{"ejection only", []ClientOption{WithEjection(1, time.Second)}},
+		{"zero interval", []ClientOption{WithEndpoints([]string{"https://api.test"}, nil), WithHealthCheck("/h", 0)}},
+	}
+	for _, tt := range tests {
+		if _, err := NewClient(tt.opts...); err == nil {
+			t.Errorf("%s: NewClient succeeded", tt.name)
+		}
+	}
+}
+
+func TestRebase(t *testing.T) {
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	tests := []struct {
+		u, from, to, want string
+		ok                bool
+	}{
+		{"https://a.test/api/users?q=1", "https://a.test/api", "http://b.test/v2/", "http://b.test/v2/users?q=1", true},
+		{"https://a.test/users/a%2Fb", "https://a.test", "https://b.test/v2", "https://b.test/v2/users/a%2Fb", true},
+		{"https://a.test/apiary", "https://a.test/api", "https://b.test", "", false},
+		{"https://other.test/api/x", "https://a.test/api", "https://b.test", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := rebase(parse(tt.u), parse(tt.from), parse(tt.to))
+		if ok != tt.ok || (ok && got.String() != tt.want) {
+			t.Errorf("rebase(%s, %s, %s) = %v %v, want %s %v", tt.u, tt.from, tt.to, got, ok, tt.want, tt.ok)
+		}
+	}
+}
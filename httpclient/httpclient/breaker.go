@@ -0,0 +1,190 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request while the breaker for its host is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a host's circuit breaker
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // requests flow normally
+	BreakerOpen                         // requests fail fast until the cooldown elapses
+	BreakerHalfOpen                     // a limited number of probe requests are let through
+)
+
+// String returns the state name
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerSettings configures the per-host circuit breaker
+type BreakerSettings struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker (default 5)
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before letting probes through (default 30s)
+	Cooldown time.Duration
+	// HalfOpenRequests is the number of concurrent probes allowed while half-open (default 1)
+	HalfOpenRequests int
+	// IsFailure classifies an attempt; by default transport errors and 5xx responses are failures
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called after a host's breaker changes state
+	OnStateChange func(host string, from, to BreakerState)
+}
+
+// WithCircuitBreaker enables a circuit breaker keyed by request host
+func WithCircuitBreaker(settings BreakerSettings) ClientOption {
+	return func(c *Client) error {
+		if settings.FailureThreshold <= 0 {
+			settings.FailureThreshold = 5
+		}
+		if settings.Cooldown <= 0 {
+			settings.Cooldown = 30 * time.Second
+		}
+		if settings.HalfOpenRequests <= 0 {
+			settings.HalfOpenRequests = 1
+		}
+		if settings.IsFailure == nil {
+			settings.IsFailure = isBreakerFailure
+		}
+		c.breakers = &circuitBreakers{settings: settings, hosts: make(map[string]*breaker)}
+		return nil
+	}
+}
+
+// circuitBreakers holds one breaker per host
+type circuitBreakers struct {
+	settings BreakerSettings
+	mu       sync.Mutex
+	hosts    map[string]*breaker
+}
+
+// breaker is the state of a single host's circuit
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// allow reports whether a request to host may be sent, moving an open breaker
+// to half-open once its cooldown has elapsed
+func (cb *circuitBreakers) allow(host string) error {
+	cb.mu.Lock()
+	b, ok := cb.hosts[host]
+	if !ok {
+		b = &breaker{}
+		cb.hosts[host] = b
+	}
+	from := b.state
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= cb.settings.Cooldown {
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+	var err error
+	switch b.state {
+	case BreakerOpen:
+		err = ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes >= cb.settings.HalfOpenRequests {
+			err = ErrCircuitOpen
+		} else {
+			b.probes++
+		}
+	}
+	to := b.state
+	cb.mu.Unlock()
+
+	cb.notify(host, from, to)
+	return err
+}
+
+// record updates host's breaker with the outcome of an allowed request. A request whose
+// context was cancelled or timed out says nothing about the host: it only frees its
+// half-open probe slot and leaves the state and failure count as they are
+func (cb *circuitBreakers) record(host string, resp *http.Response, err error, cancelled bool) {
+	if cancelled {
+		cb.mu.Lock()
+		if b := cb.hosts[host]; b.state == BreakerHalfOpen && b.probes > 0 {
+			b.probes--
+		}
+		cb.mu.Unlock()
+		return
+	}
+	failed := cb.settings.IsFailure(resp, err)
+
+	cb.mu.Lock()
+	b := cb.hosts[host]
+	from := b.state
+	switch {
+	case b.state == BreakerHalfOpen && failed:
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	case b.state == BreakerHalfOpen:
+		b.state = BreakerClosed
+		b.failures = 0
+	case failed:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= cb.settings.FailureThreshold {
+			b.state = BreakerOpen
+			b.openedAt = time.Now()
+		}
+	default:
+		b.failures = 0
+	}
+	to := b.state
+	cb.mu.Unlock()
+
+	cb.notify(host, from, to)
+}
+
+// CircuitState returns the current breaker state for host, closed if no breaker is configured
+func (c *Client) CircuitState(host string) BreakerState {
+	if c.breakers == nil {
+		return BreakerClosed
+	}
+	c.breakers.mu.Lock()
+	defer c.breakers.mu.Unlock()
+	if b, ok := c.breakers.hosts[host]; ok {
+		return b.state
+	}
+	return BreakerClosed
+}
+
+// isOpen reports whether the breaker for host is open and still cooling down
+func (cb *circuitBreakers) isOpen(host string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	b, ok := cb.hosts[host]
+	return ok && b.state == BreakerOpen && time.Since(b.openedAt) < cb.settings.Cooldown
+}
+
+// notify invokes the state change callback outside the lock
+func (cb *circuitBreakers) notify(host string, from, to BreakerState) {
+	if from != to && cb.settings.OnStateChange != nil {
+		cb.settings.OnStateChange(host, from, to)
+	}
+}
+
+// isBreakerFailure counts transport errors and server errors, but not cancellations, as failures
+func isBreakerFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,87 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// breakerServer fails on /fail, hangs on /hang until the request is cancelled and succeeds otherwise
+func breakerServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/hang":
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return srv, u.Host
+}
+
+// cancelledGet sends a request to /hang and cancels it shortly after
+func cancelledGet(t *testing.T, c *Client, base string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Get(base+"/hang", WithContext(ctx)); err == nil {
+		t.Fatal("cancelled request succeeded")
+	}
+}
+
+// status sends a request and returns its status, failing the test on errors
+func status(t *testing.T, c *Client, url string) int {
+	t.Helper()
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestBreakerCancelledProbeIsNeutral(t *testing.T) {
+	srv, host := breakerServer(t)
+	c, err := NewClient(WithRetry(0, 0), WithCircuitBreaker(BreakerSettings{FailureThreshold: 1, Cooldown: 20 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status(t, c, srv.URL+"/fail")
+	if got := c.CircuitState(host); got != BreakerOpen {
+		t.Fatalf("state = %v, want open", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	cancelledGet(t, c, srv.URL)
+	if got := c.CircuitState(host); got != BreakerHalfOpen {
+		t.Errorf("state after cancelled probe = %v, want half-open", got)
+	}
+	// The probe slot was released, so the next request is let through
+	if got := status(t, c, srv.URL+"/ok"); got != http.StatusOK {
+		t.Errorf("status = %d, want 200", got)
+	}
+	if got := c.CircuitState(host); got != BreakerClosed {
+		t.Errorf("state after successful probe = %v, want closed", got)
+	}
+}
+
+func TestBreakerCancellationKeepsFailureCount(t *testing.T) {
+	srv, host := breakerServer(t)
+	c, err := NewClient(WithRetry(0, 0), WithCircuitBreaker(BreakerSettings{FailureThreshold: 2, Cooldown: time.Minute}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status(t, c, srv.URL+"/fail")
+	cancelledGet(t, c, srv.URL)
+	status(t, c, srv.URL+"/fail")
+	if got := c.CircuitState(host); got != BreakerOpen {
+		t.Errorf("state = %v, want open after two failures around a cancellation", got)
+	}
+}
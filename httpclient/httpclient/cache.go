@@ -0,0 +1,439 @@
+package httpclient
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedBody is the largest response body stored in the cache
+const maxCachedBody = 10 << 20
+
+// CacheStatus describes how the cache answered a request
+type CacheStatus int
+
+const (
+	CacheMiss        CacheStatus = iota // fetched from the server and stored if cacheable
+	CacheHit                            // answered from a fresh stored response
+	CacheRevalidated                    // a stale response was confirmed by a 304
+	CacheBypass                         // the request or method is not cacheable
+)
+
+// String returns the status name
+func (s CacheStatus) String() string {
+	switch s {
+	case CacheMiss:
+		return "miss"
+	case CacheHit:
+		return "hit"
+	case CacheRevalidated:
+		return "revalidated"
+	case CacheBypass:
+		return "bypass"
+	}
+	return "unknown"
+}
+
+// CacheEntry is a stored response
+type CacheEntry struct {
+	StatusCode   int               `json:"status_code"`
+	Header       http.Header       `json:"header"`
+	Body         []byte            `json:"body"`
+	Vary         map[string]string `json:"vary,omitempty"` // request header values selected by Vary
+	RequestTime  time.Time         `json:"request_time"`
+	ResponseTime time.Time         `json:"response_time"`
+}
+
+// CacheStorage stores cache entries by key
+type CacheStorage interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+// WithCache enables a private HTTP cache for GET requests that honours Cache-Control,
+// Expires and Vary and revalidates stale responses with conditional requests.
+// onStatus, if set, is called with the outcome of every request
+func WithCache(storage CacheStorage, onStatus func(req *http.Request, status CacheStatus)) ClientOption {
+	return func(c *Client) error {
+		c.cache = &httpCache{storage: storage, onStatus: onStatus}
+		return nil
+	}
+}
+
+// httpCache implements RFC 9111 caching on top of a CacheStorage
+type httpCache struct {
+	storage  CacheStorage
+	onStatus func(*http.Request, CacheStatus)
+}
+
+// do answers req from the cache or with fetch, storing cacheable responses
+func (hc *httpCache) do(req *http.Request, fetch func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+	if req.Method != http.MethodGet {
+		resp, err := fetch(req)
+		if err == nil && req.Method != http.MethodHead && resp.StatusCode < 400 {
+			// Unsafe methods invalidate the stored response for the target URI
+			hc.storage.Delete(http.MethodGet + " " + req.URL.String())
+		}
+		hc.report(req, CacheBypass)
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok || req.Header.Get("Range") != "" {
+		// Partial content is never stored, so range requests go straight to the origin
+		hc.report(req, CacheBypass)
+		return fetch(req)
+	}
+
+	entry, ok := hc.storage.Get(key)
+	if ok && !entry.varyMatches(req) {
+		ok = false
+	}
+	if ok && entry.fresh(reqCC) {
+		hc.report(req, CacheHit)
+		return entry.response(req), nil
+	}
+
+	conditional := req
+	if ok {
+		conditional = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" && conditional.Header.Get("If-None-Match") == "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if lm := entry.Header.Get("Last-Modified"); lm != "" && conditional.Header.Get("If-Modified-Since") == "" {
+			conditional.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	requestTime := time.Now()
+	resp, err := fetch(conditional)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := time.Now()
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		for k, v := range resp.Header {
+			entry.Header[k] = v
+		}
+		entry.RequestTime, entry.ResponseTime = requestTime, responseTime
+		hc.storage.Set(key, entry)
+		hc.report(req, CacheRevalidated)
+		return entry.response(req), nil
+	}
+
+	hc.report(req, CacheMiss)
+	if !storable(resp) {
+		return resp, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxCachedBody {
+		resp.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	hc.storage.Set(key, &CacheEntry{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		Vary:         varyValues(req, resp.Header),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	})
+	return resp, nil
+}
+
+// report notifies the observer
+func (hc *httpCache) report(req *http.Request, status CacheStatus) {
+	if hc.onStatus != nil {
+		hc.onStatus(req, status)
+	}
+}
+
+// storable reports whether resp may be stored by a private cache. Only statuses the
+// cache understands are stored, which excludes 206 Partial Content
+func storable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+	default:
+		return false
+	}
+	respCC := parseCacheControl(resp.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+	if strings.TrimSpace(resp.Header.Get("Vary")) == "*" {
+		return false
+	}
+	if _, ok := respCC["max-age"]; ok {
+		return true
+	}
+	if resp.Header.Get("Expires") != "" {
+		return true
+	}
+	if _, ok := respCC["no-cache"]; ok {
+		return resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+	}
+	return resp.Header.Get("Last-Modified") != "" || resp.Header.Get("ETag") != ""
+}
+
+// fresh reports whether the entry can be served without revalidation
+func (e *CacheEntry) fresh(reqCC map[string]string) bool {
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	respCC := parseCacheControl(e.Header)
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+	age := e.age(time.Now())
+	if maxAge, ok := reqCC["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil && age > time.Duration(seconds)*time.Second {
+			return false
+		}
+	}
+	return e.lifetime(respCC) > age
+}
+
+// lifetime computes the freshness lifetime from max-age, Expires or a Last-Modified heuristic
+func (e *CacheEntry) lifetime(respCC map[string]string) time.Duration {
+	if maxAge, ok := respCC["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+	date := e.date()
+	if expires := e.Header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return at.Sub(date)
+	}
+	if lm, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && lm.Before(date) {
+		return min(date.Sub(lm)/10, 24*time.Hour)
+	}
+	return 0
+}
+
+// age computes the current age of the entry as described in RFC 9111 section 4.2.3
+func (e *CacheEntry) age(now time.Time) time.Duration {
+	apparent := max(e.ResponseTime.Sub(e.date()), 0)
+	ageValue := time.Duration(0)
+	if seconds, err := strconv.Atoi(e.Header.Get("Age")); err == nil {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	return max(apparent, correctedAge) + now.Sub(e.ResponseTime)
+}
+
+// date returns the response Date, falling back to the time it was received
+func (e *CacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+	return e.ResponseTime
+}
+
+// varyMatches reports whether req selects the same variant as the stored request
+func (e *CacheEntry) varyMatches(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// response builds a response for req from the entry
+func (e *CacheEntry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(e.age(time.Now()).Seconds())))
+	return &http.Response{
+		StatusCode:    e.StatusCode,
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// varyValues records the request header values named by the response's Vary header
+func varyValues(req *http.Request, header http.Header) map[string]string {
+	var values map[string]string
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				if values == nil {
+					values = make(map[string]string)
+				}
+				values[http.CanonicalHeaderKey(name)] = req.Header.Get(name)
+			}
+		}
+	}
+	return values
+}
+
+// parseCacheControl parses Cache-Control directives into lower-case names and unquoted values
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// readCloser combines a Reader with a separate Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// MemoryCache is an in-memory LRU CacheStorage
+type MemoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+// memoryItem is an element of the LRU list
+type memoryItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCache creates an LRU cache holding at most capacity entries
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{capacity: max(capacity, 1), order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get returns a copy of the entry and marks it as recently used
+func (m *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	entry := *el.Value.(*memoryItem).entry
+	entry.Header = entry.Header.Clone()
+	return &entry, true
+}
+
+// Set stores the entry, evicting the least recently used one when full
+func (m *MemoryCache) Set(key string, entry *CacheEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memoryItem).entry = entry
+		m.order.MoveToFront(el)
+		return
+	}
+	m.items[key] = m.order.PushFront(&memoryItem{key: key, entry: entry})
+	if m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryItem).key)
+	}
+}
+
+// Delete removes the entry
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.order.Remove(el)
+		delete(m.items, key)
+	}
+}
+
+// DiskCache stores entries as JSON files in a directory
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache creates a cache in dir, creating the directory if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get reads the entry from disk
+func (d *DiskCache) Get(key string) (*CacheEntry, bool) {
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Set writes the entry to disk atomically; write errors leave the cache unchanged
+func (d *DiskCache) Set(key string, entry *CacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(d.dir, "entry-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Delete removes the entry's file
+func (d *DiskCache) Delete(key string) {
+	os.Remove(d.path(key))
+}
+
+// path maps a key to a file name
+func (d *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+}
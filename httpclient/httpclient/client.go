@@ -2,41 +2,139 @@ package httpclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 )
 
+// ErrBodyNotReplayable is returned when a request has to be retried but its
+// body is a one-shot stream that cannot be sent again
+var ErrBodyNotReplayable = errors.New("request body cannot be replayed")
+
 // ClientOption defines the function type for client configuration
 type ClientOption func(*Client) error
 
 // Client wraps an http.Client with retry and TLS support
 type Client struct {
-	httpClient    *http.Client
-	retries       int
-	retryInterval time.Duration
-	baseURL       string
-	headers       map[string]string
+	httpClient         *http.Client
+	retries            int
+	retryPolicy        RetryPolicy
+	retryNonIdempotent bool
+	retryBudget        time.Duration
+	maxRetryAfter      time.Duration
+	baseURL            string
+	headers            map[string]string
+	transport          *http.Transport
+	roundTripper       http.RoundTripper
+	recorder           *recorder
+	tlsConfig          *tls.Config
+	middlewares        []Middleware
+	logger             *slog.Logger
+	errorOnStatus      func(int) bool
+	breakers           *circuitBreakers
+	limits             *limits
+	tracer             Tracer
+	metrics            Metrics
+	cache              *httpCache
+	tokens             *cachingTokenSource
+	signer             Signer
+	tlsRoots           func() *x509.CertPool
+	spkiPins           []string
+	watchers           []*certWatcher
+	hedger             *hedger
+	endpoints          *endpoints
 }
 
-// New creates a new Client with options
+// New creates a new Client with options. Options that fail are skipped;
+// use NewClient to get their errors
 func New(opts ...ClientOption) *Client {
+	c, _ := newClient(opts...)
+	return c
+}
+
+// NewClient creates a new Client with options, returning the errors of all failed
+// options and of an invalid combined configuration joined together
+func NewClient(opts ...ClientOption) (*Client, error) {
+	c, err := newClient(opts...)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient applies the options and validates the result, always returning a usable client
+func newClient(opts ...ClientOption) (*Client, error) {
 	c := &Client{
-		httpClient: &http.Client{},
-		retries:    3, // default retries
-		headers:    make(map[string]string),
+		httpClient:    &http.Client{},
+		retries:       3, // default retries
+		retryPolicy:   DefaultRetryPolicy(),
+		maxRetryAfter: DefaultMaxRetryAfter,
+		headers:       make(map[string]string),
+		logger:        slog.New(slog.DiscardHandler),
+		tracer:        NoopTracer{},
+		metrics:       NoopMetrics{},
 	}
 
 	// Apply options
+	var errs []error
 	for _, opt := range opts {
-		_ = opt(c)
+		if err := opt(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, c.validate()...)
+	c.httpClient.Transport = c.buildTransport()
+	for _, w := range c.watchers {
+		go w.watch(c)
+	}
+	if c.endpoints != nil && len(c.endpoints.list) > 0 && c.endpoints.healthInterval > 0 {
+		go c.probeEndpoints()
 	}
 
-	return c
+	return c, errors.Join(errs...)
+}
+
+// validate checks the combined configuration for settings that cannot work together
+func (c *Client) validate() []error {
+	var errs []error
+	if c.retries < 0 {
+		errs = append(errs, fmt.Errorf("retries must not be negative, got %d", c.retries))
+	}
+	if c.baseURL != "" {
+		if u, err := url.Parse(c.baseURL); err != nil {
+			errs = append(errs, fmt.Errorf("invalid base URL: %w", err))
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", c.baseURL))
+		}
+	}
+	if c.endpoints != nil {
+		switch {
+		case len(c.endpoints.list) == 0:
+			errs = append(errs, errors.New("ejection and health check options need WithEndpoints"))
+		case c.baseURL != "":
+			errs = append(errs, errors.New("WithEndpoints cannot be combined with WithBaseURL"))
+		}
+	}
+	if c.tlsConfig != nil {
+		switch {
+		case c.roundTripper != nil:
+			errs = append(errs, errors.New("TLS options have no effect on a custom RoundTripper"))
+		case c.transport != nil && c.transport.TLSClientConfig != nil:
+			errs = append(errs, errors.New("TLS options would replace the TLSClientConfig of the custom transport"))
+		case c.transport != nil && (c.transport.DialTLSContext != nil || c.transport.DialTLS != nil):
+			errs = append(errs, errors.New("TLS options have no effect on a transport with a custom DialTLS"))
+		}
+	}
+	return errs
 }
 
 // WithTimeout sets the client timeout
@@ -47,24 +145,37 @@ func WithTimeout(timeout time.Duration) ClientOption {
 	}
 }
 
-// WithRetry sets the retry count and interval
+// WithRetry sets the retry count and a fixed interval between attempts.
+// A zero interval keeps the current policy, exponential backoff by default
 func WithRetry(retries int, interval time.Duration) ClientOption {
 	return func(c *Client) error {
 		c.retries = retries
-		c.retryInterval = interval
+		if interval > 0 {
+			c.retryPolicy = &ConstantBackoff{Interval: interval}
+		}
 		return nil
 	}
 }
 
-// WithTransport sets a custom transport
+// WithTransport sets a custom base transport, wrapped by any middleware and
+// combined with the configuration from WithTLSConfig
 func WithTransport(transport *http.Transport) ClientOption {
 	return func(c *Client) error {
-		c.httpClient.Transport = transport
+		c.transport = transport
+		return nil
+	}
+}
+
+// WithRoundTripper replaces the base transport with any http.RoundTripper, such as a
+// fake from httpclienttest; TLS options do not apply to it
+func WithRoundTripper(rt http.RoundTripper) ClientOption {
+	return func(c *Client) error {
+		c.roundTripper = rt
 		return nil
 	}
 }
 
-// WithBaseURL sets the base URL for all requests
+// WithBaseURL sets the base URL that relative request URLs are resolved against
 func WithBaseURL(baseURL string) ClientOption {
 	return func(c *Client) error {
 		c.baseURL = baseURL
@@ -85,33 +196,28 @@ func WithDefaultHeaders(headers map[string]string) ClientOption {
 // WithTLSConfig sets up TLS configuration
 func WithTLSConfig(certFile, keyFile, caFile string) ClientOption {
 	return func(c *Client) error {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		tlsConfig, err := loadTLSConfig(certFile, keyFile, caFile)
 		if err != nil {
-			return fmt.Errorf("failed to load client cert: %w", err)
+			return err
 		}
-
-		caCert, err := os.ReadFile(caFile)
-		if err != nil {
-			return fmt.Errorf("failed to read CA file: %w", err)
-		}
-
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-
-		tlsConfig := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			RootCAs:      caCertPool,
-			MinVersion:   tls.VersionTLS12,
-		}
-
-		transport := &http.Transport{TLSClientConfig: tlsConfig}
-		c.httpClient.Transport = transport
+		cfg := c.tls()
+		cfg.Certificates = tlsConfig.Certificates
+		cfg.RootCAs = tlsConfig.RootCAs
 		return nil
 	}
 }
 
 // NewWithTLS creates a Client that uses a custom TLS certificate
 func NewWithTLS(timeout time.Duration, retries int, certFile, keyFile, caFile string) (*Client, error) {
+	return NewClient(
+		WithTimeout(timeout),
+		WithRetry(retries, 0),
+		WithTLSConfig(certFile, keyFile, caFile),
+	)
+}
+
+// loadTLSConfig builds a client TLS configuration from certificate, key and CA files
+func loadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load client cert: %w", err)
@@ -125,21 +231,47 @@ func NewWithTLS(timeout time.Duration, retries int, certFile, keyFile, caFile st
 	caCertPool := x509.NewCertPool()
 	caCertPool.AppendCertsFromPEM(caCert)
 
-	tlsConfig := &tls.Config{
+	return &tls.Config{
 		Certificates: []tls.Certificate{cert},
 		RootCAs:      caCertPool,
 		MinVersion:   tls.VersionTLS12,
-	}
+	}, nil
+}
 
-	transport := &http.Transport{TLSClientConfig: tlsConfig}
+// buildTransport combines the base transport, TLS configuration and middleware chain
+func (c *Client) buildTransport() http.RoundTripper {
+	base := c.transport
+	c.finishTLS()
+	if c.tlsConfig != nil {
+		if base == nil {
+			base = http.DefaultTransport.(*http.Transport).Clone()
+		} else {
+			base = base.Clone()
+		}
+		base.TLSClientConfig = c.tlsConfig
+		if c.tlsRoots != nil {
+			base.DialTLSContext = c.dialTLS(base)
+		}
+	}
 
-	return &Client{
-		httpClient: &http.Client{Timeout: timeout, Transport: transport},
-		retries:    retries,
-	}, nil
+	var rt http.RoundTripper = http.DefaultTransport
+	switch {
+	case c.roundTripper != nil:
+		rt = c.roundTripper
+	case base != nil:
+		rt = base
+	}
+	if c.recorder != nil {
+		c.recorder.next = rt
+		rt = c.recorder
+	}
+	if c.signer != nil {
+		rt = &signingTransport{signer: c.signer, next: rt}
+	}
+	return chain(rt, c.middlewares)
 }
 
-// doRequest executes an HTTP request with retry logic
+// doRequest executes an HTTP request with retry logic inside a tracing span
 func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 	// Apply default headers
 	for k, v := range c.headers {
@@ -148,64 +280,327 @@ func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 		}
 	}
 
+	ctx, span := c.tracer.Start(req.Context(), "HTTP "+req.Method)
+	defer span.End()
+	req = req.WithContext(ctx)
+	span.SetAttributes(requestAttributes(req)...)
+
 	var resp *http.Response
 	var err error
+	if c.cache != nil {
+		resp, err = c.cache.do(req, func(r *http.Request) (*http.Response, error) {
+			return c.retryLoop(r, span)
+		})
+	} else {
+		resp, err = c.retryLoop(req, span)
+	}
+	if err == nil && c.errorOnStatus != nil && c.errorOnStatus(resp.StatusCode) {
+		err = newHTTPError(resp)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(Attr("http.response.status_code", resp.StatusCode))
+	return resp, nil
+}
 
-	for attempt := 0; attempt <= c.retries; attempt++ {
-		resp, err = c.httpClient.Do(req)
-		if err == nil && (resp.StatusCode < 500 || attempt == c.retries) {
-			return resp, nil
+// retryLoop sends req until it succeeds, the retry policy gives up or its context is done.
+// The retry budget bounds the attempts and the waits between them but not the body of the
+// response finally returned, so streams can be read for as long as the caller needs
+func (c *Client) retryLoop(req *http.Request, span Span) (*http.Response, error) {
+	if c.retryBudget <= 0 {
+		return c.attempts(req, span)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(c.retryBudget, cancel)
+	resp, err := c.attempts(req.WithContext(ctx), span)
+	if !timer.Stop() && req.Context().Err() == nil {
+		// The budget ran out before a final response was returned
+		if err == nil {
+			resp.Body.Close()
 		}
-		if err != nil {
-			fmt.Printf("Attempt %d failed: %v\n", attempt+1, err)
+		cancel()
+		return nil, fmt.Errorf("%s %s: retry budget of %s exceeded: %w", req.Method, RedactURL(req.URL), c.retryBudget, context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// attempts runs the attempts of retryLoop
+func (c *Client) attempts(req *http.Request, span Span) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	ctx := req.Context()
+	start := time.Now()
+	sends := 0
+	useToken := c.tokens != nil && req.Header.Get("Authorization") == ""
+	reauthorized := false
+	tried := make(map[int]bool)
+
+	for attempt := 0; ; attempt++ {
+		attemptReq, rerr := attemptRequest(req, sends)
+		if rerr != nil {
+			return nil, fmt.Errorf("cannot retry %s %s: %w (last error: %w)", req.Method, RedactURL(req.URL), rerr, attemptErr(resp, err))
+		}
+		if sc := span.SpanContext(); sc.IsValid() {
+			attemptReq.Header.Set("traceparent", sc.TraceParent())
+		}
+		var token *Token
+		if useToken {
+			if token, err = c.tokens.Token(ctx); err != nil {
+				closeBody(attemptReq)
+				return nil, fmt.Errorf("failed to get token: %w", err)
+			}
+			attemptReq.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+		}
+		attemptReq, ep, finish := c.routeAttempt(attemptReq, tried)
+		release, aerr := c.acquire(ctx, attemptReq)
+		if aerr != nil {
+			finish()
+			closeBody(attemptReq)
+			return nil, aerr
+		}
+		if ep != nil {
+			acquired := release
+			release = func() {
+				acquired()
+				finish()
+			}
+		}
+		var latency time.Duration
+		if c.hedger != nil && hedgeable(req) {
+			resp, latency, err = c.sendHedged(attemptReq, release, span)
 		} else {
+			resp, latency, err = c.send(attemptReq, release)
+		}
+		c.recordEndpoint(ep, resp, err)
+		sends++
+
+		if useToken && !reauthorized && err == nil && resp.StatusCode == http.StatusUnauthorized {
+			// Resend once with a fresh token; this does not count as a retry
+			reauthorized = true
+			c.tokens.invalidate(token)
+			if replayable(req) {
+				resp.Body.Close()
+				attempt--
+				continue
+			}
+		}
+
+		retry := c.shouldRetry(req, resp, err, attempt)
+		delay := time.Duration(0)
+		if retry {
+			delay, retry = c.retryDelay(resp, attempt)
+			retry = retry && (c.retryBudget <= 0 || time.Since(start)+delay <= c.retryBudget)
+		}
+		c.logAttempt(attemptReq, attempt, resp, err, latency, retry)
+		if !retry {
+			if err != nil && attempt > 0 {
+				return nil, fmt.Errorf("request failed after %d retries: %w", attempt, err)
+			}
+			return resp, err
+		}
+		span.AddEvent("retry", retryAttributes(attempt, delay, resp, err)...)
+		c.metrics.IncRetries(req.Method, req.URL.Host)
+		if resp != nil {
 			resp.Body.Close()
 		}
 
-		// Use the configured retry interval or default to exponential backoff
-		if c.retryInterval > 0 {
-			time.Sleep(c.retryInterval)
-		} else {
-			time.Sleep(time.Duration(attempt+1) * time.Second)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, fmt.Errorf("request cancelled after %d attempts: %w", attempt+1, err)
 		}
 	}
-	return nil, fmt.Errorf("request failed after %d retries: %w", c.retries, err)
 }
 
-// Get performs a GET request with variadic options
-func (c *Client) Get(url string, opts ...RequestOption) (*http.Response, error) {
-	if c.baseURL != "" {
-		url = c.baseURL + url
+// acquire waits for the rate and concurrency limits and then checks the circuit breaker,
+// so a half-open probe slot is only taken by a request that is about to be sent.
+// The returned release func must be passed to send
+func (c *Client) acquire(ctx context.Context, req *http.Request) (func(), error) {
+	release := func() {}
+	if c.limits != nil {
+		var err error
+		if release, err = c.limits.wait(ctx, req.URL.Host); err != nil {
+			return nil, fmt.Errorf("waiting for rate limit: %w", err)
+		}
 	}
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
+	if c.breakers != nil {
+		if err := c.breakers.allow(req.URL.Host); err != nil {
+			release()
+			return nil, fmt.Errorf("%s %s: %w", req.Method, RedactURL(req.URL), err)
+		}
 	}
-	for _, opt := range opts {
-		if err := opt(req); err != nil {
-			return nil, err
+	return release, nil
+}
+
+// tryAcquire is acquire without waiting, reporting false if the request cannot be sent right away
+func (c *Client) tryAcquire(req *http.Request) (func(), bool) {
+	release := func() {}
+	if c.limits != nil {
+		var ok bool
+		if release, ok = c.limits.tryWait(req.URL.Host); !ok {
+			return nil, false
 		}
 	}
-	return c.doRequest(req)
+	if c.breakers != nil && c.breakers.allow(req.URL.Host) != nil {
+		release()
+		return nil, false
+	}
+	return release, true
 }
 
-// Post performs a POST request with variadic options
-func (c *Client) Post(url string, body []byte, opts ...RequestOption) (*http.Response, error) {
-	if c.baseURL != "" {
-		url = c.baseURL + url
+// send performs a single attempt and records its outcome
+func (c *Client) send(req *http.Request, release func()) (*http.Response, time.Duration, error) {
+	sent := time.Now()
+	resp, err := c.httpClient.Do(req)
+	err = redactError(err)
+	latency := time.Since(sent)
+
+	status := 0
+	if err != nil {
+		release()
+	} else {
+		status = resp.StatusCode
+		if c.limits != nil {
+			c.limits.adapt(req.URL.Host, resp, c.maxRetryAfter)
+		}
+		resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	}
+	if c.breakers != nil {
+		c.breakers.record(req.URL.Host, resp, err, err != nil && req.Context().Err() != nil)
+	}
+	c.metrics.IncRequests(req.Method, req.URL.Host, status)
+	c.metrics.ObserveLatency(req.Method, req.URL.Host, status, latency)
+	return resp, latency, err
+}
+
+// shouldRetry reports whether another attempt is allowed after the given one
+func (c *Client) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) bool {
+	if attempt >= c.retries || req.Context().Err() != nil {
+		return false
+	}
+	if !c.retryNonIdempotent && !IsIdempotent(req) {
+		return false
+	}
+	return c.retryPolicy.ShouldRetry(resp, err, attempt)
+}
+
+// attemptRequest returns the request to send after the given number of previous
+// sends, rebuilding the body through GetBody for every send after the first
+func attemptRequest(req *http.Request, sends int) (*http.Request, error) {
+	if sends == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if !replayable(req) {
+		return nil, ErrBodyNotReplayable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild request body: %w", err)
 	}
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// closeBody closes the body of a request that will not reach the transport
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// replayable reports whether req's body can be sent again
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// attemptErr describes the outcome of a failed attempt as an error
+func attemptErr(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// Do performs a request with the given method, optional body and variadic options
+func (c *Client) Do(method, url string, body []byte, opts ...RequestOption) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return c.DoStream(method, url, reader, opts...)
+}
+
+// DoStream performs a request whose body is read from an io.Reader.
+// Bytes, strings and buffers are replayed on retry automatically; any other
+// reader is sent once unless it is buffered with WithBufferedBody or rebuilt
+// with WithBodyFactory, and a retry of it fails with ErrBodyNotReplayable
+func (c *Client) DoStream(method, url string, body io.Reader, opts ...RequestOption) (*http.Response, error) {
+	base := c.baseURL
+	if c.endpoints != nil && len(c.endpoints.list) > 0 {
+		// Attempts are moved to the balanced endpoint in retryLoop
+		base = c.endpoints.list[0].raw
+	}
+	if base != "" {
+		resolved, err := resolveURL(base, url)
+		if err != nil {
+			return nil, err
+		}
+		url = resolved
+	}
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	for _, opt := range opts {
 		if err := opt(req); err != nil {
+			closeBody(req)
 			return nil, err
 		}
 	}
 	return c.doRequest(req)
 }
 
+// Get performs a GET request with variadic options
+func (c *Client) Get(url string, opts ...RequestOption) (*http.Response, error) {
+	return c.Do(http.MethodGet, url, nil, opts...)
+}
+
+// Post performs a POST request with variadic options
+func (c *Client) Post(url string, body []byte, opts ...RequestOption) (*http.Response, error) {
+	return c.Do(http.MethodPost, url, body, opts...)
+}
+
+// Put performs a PUT request with variadic options
+func (c *Client) Put(url string, body []byte, opts ...RequestOption) (*http.Response, error) {
+	return c.Do(http.MethodPut, url, body, opts...)
+}
+
+// Patch performs a PATCH request with variadic options
+func (c *Client) Patch(url string, body []byte, opts ...RequestOption) (*http.Response, error) {
+	return c.Do(http.MethodPatch, url, body, opts...)
+}
+
+// Delete performs a DELETE request with variadic options
+func (c *Client) Delete(url string, opts ...RequestOption) (*http.Response, error) {
+	return c.Do(http.MethodDelete, url, nil, opts...)
+}
+
+// Head performs a HEAD request with variadic options
+func (c *Client) Head(url string, opts ...RequestOption) (*http.Response, error) {
+	return c.Do(http.MethodHead, url, nil, opts...)
+}
+
+// Options performs an OPTIONS request with variadic options
+func (c *Client) Options(url string, opts ...RequestOption) (*http.Response, error) {
+	return c.Do(http.MethodOptions, url, nil, opts...)
+}
+
 // ReadBody helper to read response body
 func ReadBody(resp *http.Response) ([]byte, error) {
 	defer resp.Body.Close()
@@ -0,0 +1,229 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when a downloaded file does not match the expected digest
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// DownloadOption configures Client.Download
+type DownloadOption func(*downloadConfig)
+
+// downloadConfig holds the download settings
+type downloadConfig struct {
+	sha256   string
+	progress ProgressFunc
+	opts     []RequestOption
+}
+
+// WithSHA256 verifies the downloaded file against a hex-encoded SHA-256 digest
+func WithSHA256(digest string) DownloadOption {
+	return func(cfg *downloadConfig) {
+		cfg.sha256 = strings.ToLower(digest)
+	}
+}
+
+// WithDownloadProgress reports the bytes written so far and the total size, or -1 if unknown
+func WithDownloadProgress(fn ProgressFunc) DownloadOption {
+	return func(cfg *downloadConfig) {
+		cfg.progress = fn
+	}
+}
+
+// WithDownloadRequestOptions applies request options to every download request
+func WithDownloadRequestOptions(opts ...RequestOption) DownloadOption {
+	return func(cfg *downloadConfig) {
+		cfg.opts = append(cfg.opts, opts...)
+	}
+}
+
+// Download streams url to the file dst. When the transfer breaks it resumes with a
+// Range request guarded by If-Range, and restarts if the server cannot resume or the
+// first response had no strong ETag or Last-Modified to guard the resume with.
+// The file is written to dst+".part" and renamed once complete and verified
+func (c *Client) Download(ctx context.Context, url, dst string, opts ...DownloadOption) error {
+	cfg := &downloadConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	part := dst + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return fmt.Errorf("failed to create download file: %w", err)
+	}
+	d := &download{file: f, hash: sha256.New(), total: -1, progress: cfg.progress}
+	err = d.run(ctx, c, url, cfg.opts)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to close download file: %w", cerr)
+	}
+	if err == nil && cfg.sha256 != "" {
+		if sum := hex.EncodeToString(d.hash.Sum(nil)); sum != cfg.sha256 {
+			err = fmt.Errorf("%w: got sha256 %s, want %s", ErrChecksumMismatch, sum, cfg.sha256)
+		}
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, dst)
+}
+
+// download is the state of one transfer across attempts
+type download struct {
+	file      *os.File
+	hash      hash.Hash
+	written   int64
+	total     int64
+	validator string // strong ETag or Last-Modified used for If-Range
+	progress  ProgressFunc
+}
+
+// run fetches the file, resuming after failed attempts up to the client's retry count
+func (d *download) run(ctx context.Context, c *Client, url string, opts []RequestOption) error {
+	for failures := 0; ; failures++ {
+		done, err := d.attempt(ctx, c, url, opts)
+		if done || err == nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if failures >= c.retries {
+			return fmt.Errorf("download failed after %d retries: %w", failures, err)
+		}
+		if err := sleepContext(ctx, c.retryPolicy.Backoff(failures)); err != nil {
+			return err
+		}
+	}
+}
+
+// attempt performs one request. done is true when err is final and must not be retried
+func (d *download) attempt(ctx context.Context, c *Client, url string, opts []RequestOption) (done bool, err error) {
+	reqOpts := append([]RequestOption{WithContext(ctx)}, opts...)
+	if d.written > 0 && d.validator == "" {
+		// Without a validator a changed file cannot be detected, so resuming could
+		// stitch two versions together
+		if err := d.restart(); err != nil {
+			return true, err
+		}
+	}
+	if d.written > 0 {
+		reqOpts = append(reqOpts, WithHeader("Range", fmt.Sprintf("bytes=%d-", d.written)), WithHeader("If-Range", d.validator))
+	}
+	resp, err := c.Get(url, reqOpts...)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if err := d.restart(); err != nil {
+			return true, err
+		}
+		d.total = resp.ContentLength
+	case resp.StatusCode == http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != d.written {
+			// The server sent a different range than requested, start over
+			if err := d.restart(); err != nil {
+				return true, err
+			}
+			return false, fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		d.total = total
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.written > 0 && d.written == d.total:
+		return true, nil
+	default:
+		return true, newHTTPError(resp)
+	}
+	if d.validator == "" {
+		d.validator = rangeValidator(resp.Header)
+	}
+
+	if _, err := io.Copy(d, resp.Body); err != nil {
+		return false, err
+	}
+	if d.total >= 0 && d.written != d.total {
+		return false, fmt.Errorf("download incomplete: %d of %d bytes", d.written, d.total)
+	}
+	return true, nil
+}
+
+// Write appends p to the file and the running digest
+func (d *download) Write(p []byte) (int, error) {
+	n, err := d.file.Write(p)
+	d.hash.Write(p[:n])
+	d.written += int64(n)
+	if d.progress != nil {
+		d.progress(d.written, d.total)
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to write download file: %w", err)
+	}
+	return n, nil
+}
+
+// restart discards everything written so far
+func (d *download) restart() error {
+	if d.written == 0 {
+		return nil
+	}
+	if err := d.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate download file: %w", err)
+	}
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind download file: %w", err)
+	}
+	d.hash.Reset()
+	d.written = 0
+	d.validator = ""
+	return nil
+}
+
+// rangeValidator returns a validator suitable for If-Range: a strong ETag or Last-Modified
+func rangeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+// parseContentRange parses "bytes start-end/total", returning -1 for an unknown total
+func parseContentRange(value string) (start, total int64, ok bool) {
+	rest, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	span, size, found := strings.Cut(rest, "/")
+	if !found {
+		return 0, 0, false
+	}
+	first, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, total, true
+}
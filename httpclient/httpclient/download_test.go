@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyFileServer serves content, dropping the connection halfway through the first
+// response. etag is sent as the validator if set
+func flakyFileServer(t *testing.T, content, etag string) (*httptest.Server, func() []http.Header) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Header.Clone())
+		first := len(requests) == 1
+		mu.Unlock()
+
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		start := 0
+		if rng := r.Header.Get("Range"); rng != "" && r.Header.Get("If-Range") == etag {
+			fmt.Sscanf(rng, "bytes=%d-", &start)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)-start))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		if !first {
+			w.Write([]byte(content[start:]))
+			return
+		}
+		w.Write([]byte(content[:len(content)/2]))
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	const content = "0123456789abcdefghij"
+	tests := []struct {
+		name      string
+		etag      string
+		wantRange string
+	}{
+		{"strong etag resumes", `"v1"`, "bytes=10-"},
+		{"no validator restarts", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := flakyFileServer(t, content, tt.etag)
+			c, err := NewClient(WithRetry(2, time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := filepath.Join(t.TempDir(), "file")
+			if err := c.Download(context.Background(), srv.URL, dst); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(dst); string(got) != content {
+				t.Errorf("file = %q, want %q", got, content)
+			}
+			reqs := requests()
+			if len(reqs) != 2 {
+				t.Fatalf("got %d requests, want 2", len(reqs))
+			}
+			if got := reqs[1].Get("Range"); got != tt.wantRange {
+				t.Errorf("Range = %q, want %q", got, tt.wantRange)
+			}
+			if got := reqs[1].Get("If-Range"); tt.wantRange != "" && got != tt.etag {
+				t.Errorf("If-Range = %q, want %q", got, tt.etag)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxErrorBody bounds how much of a failed response body is kept in an HTTPError
+const maxErrorBody = 4096
+
+// HTTPError is returned for responses with an unexpected status code; use errors.As to inspect it
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte // at most the first 4KiB of the response body
+}
+
+// Error implements the error interface
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+	return msg
+}
+
+// newHTTPError builds an HTTPError from resp, reading a bounded snippet of its body and closing it
+func newHTTPError(resp *http.Response) *HTTPError {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = RedactURL(resp.Request.URL)
+	}
+	return e
+}
+
+// WithErrorOnStatus turns responses whose status matches isError into an *HTTPError,
+// closing their body, instead of returning them to the caller
+func WithErrorOnStatus(isError func(status int) bool) ClientOption {
+	return func(c *Client) error {
+		c.errorOnStatus = isError
+		return nil
+	}
+}
+
+// NonSuccess reports whether a status code is outside the 2xx range
+func NonSuccess(status int) bool {
+	return status < 200 || status > 299
+}
@@ -0,0 +1,286 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ProgressFunc is called as a body is sent with the bytes written so far and the total, or -1 if unknown
+type ProgressFunc func(written, total int64)
+
+// WithForm sets an application/x-www-form-urlencoded body from values
+func WithForm(values url.Values) RequestOption {
+	return func(req *http.Request) error {
+		encoded := values.Encode()
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return WithBodyFactory(func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(encoded)), nil
+		}, int64(len(encoded)))(req)
+	}
+}
+
+// MultipartForm builds a multipart/form-data body that is encoded while it is sent
+type MultipartForm struct {
+	fields   []multipartField
+	progress ProgressFunc
+	boundary string
+}
+
+// multipartField is a form value or a file part
+type multipartField struct {
+	name        string
+	value       string
+	fileName    string
+	contentType string
+	path        string                        // file read from disk, reopened for every attempt
+	open        func() (io.ReadCloser, error) // file read from a reader
+	once        bool                          // reader that cannot be rewound
+	size        int64                         // -1 if unknown
+}
+
+// NewMultipartForm creates an empty multipart form
+func NewMultipartForm() *MultipartForm {
+	return &MultipartForm{boundary: multipart.NewWriter(io.Discard).Boundary()}
+}
+
+// Field adds a form value
+func (f *MultipartForm) Field(name, value string) *MultipartForm {
+	f.fields = append(f.fields, multipartField{name: name, value: value, size: int64(len(value))})
+	return f
+}
+
+// File adds a file read from disk; it is reopened on every attempt so the upload can be retried
+func (f *MultipartForm) File(name, path string) *MultipartForm {
+	size := int64(-1)
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	f.fields = append(f.fields, multipartField{name: name, fileName: filepath.Base(path), path: path, size: size})
+	return f
+}
+
+// Reader adds a file part read from r. The form can only be sent once unless r is an io.Seeker
+func (f *MultipartForm) Reader(name, fileName string, r io.Reader) *MultipartForm {
+	used := false
+	open := func() (io.ReadCloser, error) {
+		if used {
+			seeker, ok := r.(io.Seeker)
+			if !ok {
+				return nil, ErrBodyNotReplayable
+			}
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		used = true
+		return io.NopCloser(r), nil
+	}
+	_, seekable := r.(io.Seeker)
+	f.fields = append(f.fields, multipartField{name: name, fileName: fileName, open: open, once: !seekable, size: -1})
+	return f
+}
+
+// ContentType sets the Content-Type of the most recently added file part
+func (f *MultipartForm) ContentType(contentType string) *MultipartForm {
+	if n := len(f.fields); n > 0 {
+		f.fields[n-1].contentType = contentType
+	}
+	return f
+}
+
+// Progress sets a callback reporting how much of the body has been sent
+func (f *MultipartForm) Progress(fn ProgressFunc) *MultipartForm {
+	f.progress = fn
+	return f
+}
+
+// WithMultipart sets a streamed multipart/form-data body with the matching boundary Content-Type.
+// A form with a Reader part that cannot seek has no GetBody, as it can only be sent once
+func WithMultipart(form *MultipartForm) RequestOption {
+	return func(req *http.Request) error {
+		req.Header.Set("Content-Type", "multipart/form-data; boundary="+form.boundary)
+		if form.replayable() {
+			return WithBodyFactory(form.open, form.contentLength())(req)
+		}
+		body, _ := form.open()
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		req.Body = body
+		req.GetBody = nil
+		req.ContentLength = form.contentLength()
+		return nil
+	}
+}
+
+// replayable reports whether every part can be read again
+func (f *MultipartForm) replayable() bool {
+	for _, field := range f.fields {
+		if field.once {
+			return false
+		}
+	}
+	return true
+}
+
+// open returns a body that starts encoding the form into a pipe on its first Read,
+// so a request that never reaches the transport leaves no encoder running
+func (f *MultipartForm) open() (io.ReadCloser, error) {
+	body := &lazyPipe{write: f.write}
+	if f.progress == nil {
+		return body, nil
+	}
+	return &progressReader{ReadCloser: body, total: f.contentLength(), progress: f.progress}, nil
+}
+
+// lazyPipe runs write into a pipe once it is first read
+type lazyPipe struct {
+	write  func(io.Writer) error
+	mu     sync.Mutex
+	pr     *io.PipeReader
+	closed bool
+}
+
+// Read starts the writer on first use and reads from the pipe
+func (p *lazyPipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	if p.pr == nil {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(p.write(pw))
+		}()
+		p.pr = pr
+	}
+	pr := p.pr
+	p.mu.Unlock()
+	return pr.Read(b)
+}
+
+// Close stops the writer if it was started
+func (p *lazyPipe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.pr != nil {
+		return p.pr.Close()
+	}
+	return nil
+}
+
+// write encodes every field to w
+func (f *MultipartForm) write(w io.Writer) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(f.boundary); err != nil {
+		return err
+	}
+	for _, field := range f.fields {
+		if field.path == "" && field.open == nil {
+			if err := mw.WriteField(field.name, field.value); err != nil {
+				return err
+			}
+			continue
+		}
+		part, err := mw.CreatePart(field.header())
+		if err != nil {
+			return err
+		}
+		if err := field.copyTo(part); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// header returns the MIME header of a file part
+func (field multipartField) header() textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(field.name), escapeQuotes(field.fileName)))
+	contentType := field.contentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	return h
+}
+
+// copyTo streams the file contents to w
+func (field multipartField) copyTo(w io.Writer) error {
+	open := field.open
+	if field.path != "" {
+		open = func() (io.ReadCloser, error) { return os.Open(field.path) }
+	}
+	r, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to open multipart file %q: %w", field.name, err)
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// contentLength computes the encoded size, or -1 if a part's size is unknown
+func (f *MultipartForm) contentLength() int64 {
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+	mw.SetBoundary(f.boundary)
+	var files int64
+	for _, field := range f.fields {
+		if field.path == "" && field.open == nil {
+			mw.WriteField(field.name, field.value)
+			continue
+		}
+		if field.size < 0 {
+			return -1
+		}
+		mw.CreatePart(field.header())
+		files += field.size
+	}
+	mw.Close()
+	return counter.n + files
+}
+
+// escapeQuotes escapes a Content-Disposition parameter value
+func escapeQuotes(s string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+// Write counts p
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// progressReader reports the bytes read through it
+type progressReader struct {
+	io.ReadCloser
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+// Read reads from the underlying body and reports progress
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.written += int64(n)
+		r.progress(r.written, r.total)
+	}
+	return n, err
+}
@@ -0,0 +1,253 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// hedgeSamples is the number of recent latencies kept for percentile delays
+	hedgeSamples = 128
+	// hedgeMinSamples is the number of latencies needed before the percentile is used
+	hedgeMinSamples = 20
+	// hedgeBudgetCap bounds the hedge tokens saved up while traffic is healthy
+	hedgeBudgetCap = 10
+)
+
+// HedgeSettings configures request hedging
+type HedgeSettings struct {
+	// Delay before a hedge is sent, and the fallback while too few latencies are known for Percentile
+	Delay time.Duration
+	// Percentile of recent attempt latencies, between 0 and 1, used as the delay once enough are known
+	Percentile float64
+	// MaxHedges is the number of extra copies per attempt (default 1)
+	MaxHedges int
+	// BudgetRatio is the share of requests that may be hedged over time (default 0.1)
+	BudgetRatio float64
+}
+
+// WithHedging sends extra copies of idempotent reads that have not answered within the
+// hedge delay. The first successful response wins and the others are cancelled. Hedges have
+// their own budget and are independent of retries; each retry attempt may be hedged again
+func WithHedging(settings HedgeSettings) ClientOption {
+	return func(c *Client) error {
+		if settings.Delay <= 0 && settings.Percentile <= 0 {
+			return errors.New("hedging needs a delay or a latency percentile")
+		}
+		if settings.Percentile < 0 || settings.Percentile > 1 {
+			return fmt.Errorf("hedge percentile %v is not between 0 and 1", settings.Percentile)
+		}
+		if settings.MaxHedges <= 0 {
+			settings.MaxHedges = 1
+		}
+		if settings.BudgetRatio <= 0 {
+			settings.BudgetRatio = 0.1
+		}
+		c.hedger = &hedger{settings: settings, budget: hedgeBudgetCap}
+		return nil
+	}
+}
+
+// hedger tracks recent latencies and the hedge budget
+type hedger struct {
+	settings  HedgeSettings
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+	budget    float64
+}
+
+// hedgeable reports whether req is a read that can be sent more than once
+func hedgeable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return replayable(req)
+	}
+	return false
+}
+
+// delay returns how long to wait for an attempt before hedging it
+func (h *hedger) delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.settings.Percentile <= 0 || len(h.latencies) < hedgeMinSamples {
+		if h.settings.Delay > 0 {
+			return h.settings.Delay
+		}
+		return -1
+	}
+	sorted := slices.Clone(h.latencies)
+	slices.Sort(sorted)
+	i := int(h.settings.Percentile*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// observe records the latency of a completed attempt
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeSamples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeSamples
+}
+
+// deposit credits the budget for one hedgeable attempt
+func (h *hedger) deposit() {
+	h.mu.Lock()
+	h.budget = min(h.budget+h.settings.BudgetRatio, hedgeBudgetCap)
+	h.mu.Unlock()
+}
+
+// withdraw takes one hedge from the budget, reporting whether it was available
+func (h *hedger) withdraw() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.budget < 1 {
+		return false
+	}
+	h.budget--
+	return true
+}
+
+// refund returns a hedge that was not sent to the budget
+func (h *hedger) refund() {
+	h.mu.Lock()
+	h.budget = min(h.budget+1, hedgeBudgetCap)
+	h.mu.Unlock()
+}
+
+// hedgeResult is the outcome of one copy of an attempt
+type hedgeResult struct {
+	resp    *http.Response
+	latency time.Duration
+	err     error
+	cancel  context.CancelFunc
+	index   int
+}
+
+// sendHedged performs one attempt, sending further copies each time the hedge delay
+// passes without a successful response. It returns the first success, or the last
+// failure once every copy has failed
+func (c *Client) sendHedged(req *http.Request, release func(), span Span) (*http.Response, time.Duration, error) {
+	h := c.hedger
+	h.deposit()
+	ctx := req.Context()
+	results := make(chan hedgeResult, 1+h.settings.MaxHedges)
+	var cancels []context.CancelFunc
+	launch := func(r *http.Request, release func()) {
+		hctx, cancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, latency, err := c.send(r.WithContext(hctx), release)
+			results <- hedgeResult{resp: resp, latency: latency, err: err, cancel: cancel, index: index}
+		}()
+	}
+
+	launch(req, release)
+	pending, hedges := 1, 0
+	var timer <-chan time.Time
+	if d := h.delay(); d >= 0 {
+		timer = time.After(d)
+	}
+	var last hedgeResult
+	for {
+		select {
+		case <-timer:
+			timer = nil
+			if hedges >= h.settings.MaxHedges || !h.withdraw() {
+				continue
+			}
+			hedgeReq, err := attemptRequest(req, 1)
+			if err != nil {
+				h.refund()
+				continue
+			}
+			// Waiting for the limiter here would delay receiving the primary result
+			hedgeRelease, ok := c.tryAcquire(req)
+			if !ok {
+				closeBody(hedgeReq)
+				h.refund()
+				continue
+			}
+			hedges++
+			pending++
+			span.AddEvent("hedge", Attr("http.request.hedge_count", hedges))
+			c.logger.Debug("hedging request", "method", req.Method, "url", RedactURL(req.URL), "hedge", hedges)
+			launch(hedgeReq, hedgeRelease)
+			if hedges < h.settings.MaxHedges {
+				timer = time.After(h.delay())
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				h.observe(r.latency)
+			}
+			if last.cancel != nil {
+				last.close()
+			}
+			last = r
+			if r.err == nil && r.resp.StatusCode < 500 {
+				if pending > 0 {
+					for i, cancel := range cancels {
+						if i != r.index {
+							cancel()
+						}
+					}
+					go drainHedges(results, pending)
+				}
+				return r.finish()
+			}
+			if pending == 0 {
+				return r.finish()
+			}
+		}
+	}
+}
+
+// finish hands the result to the caller, cancelling the copy's context when its body is closed
+func (r hedgeResult) finish() (*http.Response, time.Duration, error) {
+	if r.err != nil {
+		r.cancel()
+		return nil, r.latency, r.err
+	}
+	r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: r.cancel}
+	return r.resp, r.latency, nil
+}
+
+// close discards a result that lost the race
+func (r hedgeResult) close() {
+	if r.resp != nil {
+		r.resp.Body.Close()
+	}
+	r.cancel()
+}
+
+// drainHedges discards the cancelled copies still in flight after a winner
+func drainHedges(results <-chan hedgeResult, pending int) {
+	for range pending {
+		(<-results).close()
+	}
+}
+
+// cancelOnClose cancels the attempt context once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the context
+func (r *cancelOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
@@ -0,0 +1,87 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowFirst answers every odd request after delay and the others at once,
+// counting requests that were cancelled while waiting
+func slowFirst(t *testing.T, delay time.Duration, cancelled *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1)%2 == 1 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				cancelled.Add(1)
+				return
+			}
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHedgeWins(t *testing.T) {
+	var cancelled atomic.Int32
+	srv := slowFirst(t, 2*time.Second, &cancelled)
+	tracer := &RecordingTracer{}
+	c, err := NewClient(WithTracer(tracer), WithHedging(HedgeSettings{Delay: 20 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	status, body := get(t, c, srv.URL)
+	if status != http.StatusOK || body != "ok" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v, want the hedge to answer", elapsed)
+	}
+	deadline := time.Now().Add(time.Second)
+	for cancelled.Load() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if cancelled.Load() != 1 {
+		t.Error("losing attempt was not cancelled")
+	}
+	if spans := tracer.Spans(); len(spans) != 1 || len(spans[0].Events) != 1 || spans[0].Events[0].Name != "hedge" {
+		t.Errorf("spans = %+v, want one hedge event", spans)
+	}
+}
+
+func TestHedgeSkippedWhenRateLimited(t *testing.T) {
+	var cancelled atomic.Int32
+	srv := slowFirst(t, 100*time.Millisecond, &cancelled)
+	c, err := NewClient(WithRateLimit(0.1, 1), WithHedging(HedgeSettings{Delay: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if status, _ := get(t, c, srv.URL); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v, want the hedge skipped instead of waiting for the limiter", elapsed)
+	}
+	if cancelled.Load() != 0 {
+		t.Error("primary attempt was cancelled")
+	}
+}
+
+func TestHedgingSettings(t *testing.T) {
+	if _, err := NewClient(WithHedging(HedgeSettings{})); err == nil {
+		t.Error("accepted hedging without a delay or percentile")
+	}
+	if _, err := NewClient(WithHedging(HedgeSettings{Percentile: 1.5})); err == nil {
+		t.Error("accepted a percentile above 1")
+	}
+}
@@ -0,0 +1,146 @@
+package httpclienttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// TokenServer is a local OAuth2 token endpoint supporting the client credentials
+// and refresh token grants, for testing token sources
+type TokenServer struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+	ExpiresIn    time.Duration
+
+	mu      sync.Mutex
+	issued  int
+	valid   map[string]bool
+	refresh map[string]bool
+}
+
+// NewTokenServer starts a token server accepting the given client credentials.
+// Tokens expire after an hour unless ExpiresIn is changed
+func NewTokenServer(clientID, clientSecret string) *TokenServer {
+	ts := &TokenServer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		ExpiresIn:    time.Hour,
+		valid:        make(map[string]bool),
+		refresh:      make(map[string]bool),
+	}
+	ts.Server = httptest.NewServer(http.HandlerFunc(ts.serveToken))
+	return ts
+}
+
+// TokenURL returns the URL of the token endpoint
+func (ts *TokenServer) TokenURL() string {
+	return ts.URL + "/token"
+}
+
+// IssueRefreshToken registers and returns a refresh token the server will accept
+func (ts *TokenServer) IssueRefreshToken() string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.issued++
+	token := fmt.Sprintf("refresh-%d", ts.issued)
+	ts.refresh[token] = true
+	return token
+}
+
+// Issued returns the number of tokens issued so far
+func (ts *TokenServer) Issued() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.issued
+}
+
+// Valid reports whether an access token was issued and not revoked
+func (ts *TokenServer) Valid(accessToken string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.valid[accessToken]
+}
+
+// Revoke invalidates an access token, e.g. to make a resource server answer 401
+func (ts *TokenServer) Revoke(accessToken string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.valid, accessToken)
+}
+
+// Authorize wraps a handler so it answers 401 unless the request carries a valid Bearer token
+func (ts *TokenServer) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if len(auth) <= len(prefix) || auth[:len(prefix)] != prefix || !ts.Valid(auth[len(prefix):]) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveToken handles token requests
+func (ts *TokenServer) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/token" {
+		http.NotFound(w, r)
+		return
+	}
+	// Client credentials are form-encoded before Basic auth (RFC 6749 section 2.3.1)
+	id, secret, ok := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if !ok || id != ts.ClientID || secret != ts.ClientSecret {
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+	case "refresh_token":
+		old := r.PostForm.Get("refresh_token")
+		if !ts.refresh[old] {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		delete(ts.refresh, old)
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	ts.issued++
+	access := fmt.Sprintf("access-%d", ts.issued)
+	refresh := fmt.Sprintf("refresh-%d", ts.issued)
+	ts.valid[access] = true
+	ts.refresh[refresh] = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  access,
+		"token_type":    "bearer",
+		"refresh_token": refresh,
+		"expires_in":    int64(ts.ExpiresIn / time.Second),
+	})
+}
+
+// writeTokenError writes an OAuth2 error response
+func writeTokenError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
@@ -0,0 +1,309 @@
+// Package httpclienttest provides a scriptable fake transport for testing code
+// that uses httpclient.Client without starting a real server
+package httpclienttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TB is the subset of testing.TB used to report failed expectations
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Call is a request received by the Transport
+type Call struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Transport is an http.RoundTripper that answers requests from scripted expectations.
+// Plug it into a client with httpclient.WithRoundTripper
+type Transport struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+	unmatched    []string
+}
+
+// NewTransport creates a Transport with no expectations
+func NewTransport() *Transport {
+	return &Transport{}
+}
+
+// On registers an expectation for requests with the given method and path.
+// The path may contain path.Match wildcards; an empty method matches any method
+func (t *Transport) On(method, pathPattern string) *Expectation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := &Expectation{method: method, path: pathPattern, times: -1}
+	t.expectations = append(t.expectations, e)
+	return e
+}
+
+// RoundTrip answers req with the next step of the first matching expectation
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	t.calls = append(t.calls, Call{Method: req.Method, URL: req.URL.String(), Header: req.Header.Clone(), Body: body})
+	var matched *step
+	for _, e := range t.expectations {
+		if e.matches(req, body) {
+			matched = e.next()
+			break
+		}
+	}
+	if matched == nil {
+		t.unmatched = append(t.unmatched, req.Method+" "+req.URL.String())
+	}
+	t.mu.Unlock()
+
+	if matched == nil {
+		return nil, fmt.Errorf("httpclienttest: no expectation matches %s %s", req.Method, req.URL)
+	}
+	if err := wait(req.Context(), matched.delay); err != nil {
+		return nil, err
+	}
+	if matched.err != nil {
+		return nil, matched.err
+	}
+	if matched.handler != nil {
+		return matched.handler(req)
+	}
+	return newResponse(req, matched.status, matched.header, matched.body), nil
+}
+
+// Calls returns every request received so far, in order
+func (t *Transport) Calls() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Call(nil), t.calls...)
+}
+
+// AssertExpectations reports expectations that were not called as scripted
+// and requests that matched no expectation
+func (t *Transport) AssertExpectations(tb TB) bool {
+	tb.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ok := true
+	for _, e := range t.expectations {
+		if want := e.expectedCalls(); e.calls < want || (e.times >= 0 && e.calls != want) {
+			tb.Errorf("httpclienttest: %s expected %d call(s), got %d", e, want, e.calls)
+			ok = false
+		}
+	}
+	for _, u := range t.unmatched {
+		tb.Errorf("httpclienttest: unexpected request %s", u)
+		ok = false
+	}
+	return ok
+}
+
+// Expectation matches requests and answers them with a sequence of scripted steps.
+// Once the sequence is exhausted the last step is repeated
+type Expectation struct {
+	method  string
+	path    string
+	query   map[string]string
+	header  map[string]string
+	body    func([]byte) bool
+	steps   []*step
+	times   int
+	calls   int
+	pending time.Duration
+}
+
+// step is one scripted answer
+type step struct {
+	status  int
+	header  http.Header
+	body    []byte
+	err     error
+	delay   time.Duration
+	handler func(*http.Request) (*http.Response, error)
+}
+
+// WithQuery requires a query parameter to have the given value
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	if e.query == nil {
+		e.query = make(map[string]string)
+	}
+	e.query[key] = value
+	return e
+}
+
+// WithHeader requires a request header to have the given value
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	if e.header == nil {
+		e.header = make(map[string]string)
+	}
+	e.header[key] = value
+	return e
+}
+
+// WithBody requires the request body to contain substr
+func (e *Expectation) WithBody(substr string) *Expectation {
+	return e.WithBodyFunc(func(b []byte) bool { return bytes.Contains(b, []byte(substr)) })
+}
+
+// WithBodyFunc requires the request body to satisfy match
+func (e *Expectation) WithBodyFunc(match func([]byte) bool) *Expectation {
+	e.body = match
+	return e
+}
+
+// Times sets the exact number of calls AssertExpectations expects
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Delay makes the next scripted step wait before answering, or fail early if the request context ends
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.pending = d
+	return e
+}
+
+// Respond appends a response with the given status and body
+func (e *Expectation) Respond(status int, body string) *Expectation {
+	return e.add(&step{status: status, body: []byte(body)})
+}
+
+// RespondWithHeaders appends a response with the given status, headers and body
+func (e *Expectation) RespondWithHeaders(status int, header http.Header, body string) *Expectation {
+	return e.add(&step{status: status, header: header, body: []byte(body)})
+}
+
+// RespondJSON appends a response with v encoded as JSON
+func (e *Expectation) RespondJSON(status int, v any) *Expectation {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("httpclienttest: cannot encode response: %v", err))
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	return e.add(&step{status: status, header: header, body: data})
+}
+
+// Fail appends a step that returns err instead of a response
+func (e *Expectation) Fail(err error) *Expectation {
+	return e.add(&step{err: err})
+}
+
+// Handle appends a step answered by fn
+func (e *Expectation) Handle(fn func(*http.Request) (*http.Response, error)) *Expectation {
+	return e.add(&step{handler: fn})
+}
+
+// String describes the expectation
+func (e *Expectation) String() string {
+	method := e.method
+	if method == "" {
+		method = "*"
+	}
+	return method + " " + e.path
+}
+
+// add appends a step, attaching any pending delay
+func (e *Expectation) add(s *step) *Expectation {
+	s.delay = e.pending
+	e.pending = 0
+	e.steps = append(e.steps, s)
+	return e
+}
+
+// matches reports whether req satisfies every condition of the expectation
+func (e *Expectation) matches(req *http.Request, body []byte) bool {
+	if e.method != "" && !strings.EqualFold(e.method, req.Method) {
+		return false
+	}
+	if ok, _ := path.Match(e.path, req.URL.Path); !ok {
+		return false
+	}
+	if e.times >= 0 && e.calls >= e.times {
+		return false
+	}
+	q := req.URL.Query()
+	for k, v := range e.query {
+		if q.Get(k) != v {
+			return false
+		}
+	}
+	for k, v := range e.header {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	return e.body == nil || e.body(body)
+}
+
+// next returns the step for the current call and advances the sequence
+func (e *Expectation) next() *step {
+	e.calls++
+	if len(e.steps) == 0 {
+		return &step{status: http.StatusOK}
+	}
+	return e.steps[min(e.calls, len(e.steps))-1]
+}
+
+// expectedCalls is the minimum number of calls the expectation needs
+func (e *Expectation) expectedCalls() int {
+	if e.times >= 0 {
+		return e.times
+	}
+	return max(len(e.steps), 1)
+}
+
+// newResponse builds a response for req
+func newResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// wait sleeps for d unless ctx ends first
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
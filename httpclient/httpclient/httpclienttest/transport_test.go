@@ -0,0 +1,105 @@
+package httpclienttest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// recordingTB collects reported failures
+type recordingTB struct {
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// get sends a request through tr and returns the status and body
+func get(t *testing.T, tr *Transport, method, url string, header http.Header, body string) (int, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b), nil
+}
+
+func TestTransportMatching(t *testing.T) {
+	tr := NewTransport()
+	tr.On(http.MethodGet, "/users/*").WithQuery("active", "true").Respond(http.StatusOK, "active")
+	tr.On(http.MethodGet, "/users/*").Respond(http.StatusOK, "all")
+	tr.On(http.MethodPost, "/users").WithHeader("Content-Type", "application/json").WithBody(`"bob"`).
+		Respond(http.StatusConflict, "").Respond(http.StatusCreated, "created")
+
+	tests := []struct {
+		method, url string
+		header      http.Header
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{http.MethodGet, "http://x/users/1?active=true", nil, "", http.StatusOK, "active"},
+		{http.MethodGet, "http://x/users/1", nil, "", http.StatusOK, "all"},
+		{http.MethodPost, "http://x/users", http.Header{"Content-Type": {"application/json"}}, `{"name":"bob"}`, http.StatusConflict, ""},
+		{http.MethodPost, "http://x/users", http.Header{"Content-Type": {"application/json"}}, `{"name":"bob"}`, http.StatusCreated, "created"},
+		// The last step repeats once the sequence is exhausted
+		{http.MethodPost, "http://x/users", http.Header{"Content-Type": {"application/json"}}, `{"name":"bob"}`, http.StatusCreated, "created"},
+	}
+	for _, tt := range tests {
+		status, body, err := get(t, tr, tt.method, tt.url, tt.header, tt.body)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.url, err)
+		}
+		if status != tt.wantStatus || body != tt.wantBody {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.url, status, body, tt.wantStatus, tt.wantBody)
+		}
+	}
+	if _, _, err := get(t, tr, http.MethodDelete, "http://x/users/1", nil, ""); err == nil {
+		t.Error("unmatched request did not fail")
+	}
+	if calls := tr.Calls(); len(calls) != 6 || string(calls[2].Body) != `{"name":"bob"}` {
+		t.Errorf("calls = %+v", calls)
+	}
+}
+
+func TestAssertExpectations(t *testing.T) {
+	tr := NewTransport()
+	tr.On(http.MethodGet, "/once").Times(1)
+	tr.On(http.MethodGet, "/twice").Respond(http.StatusOK, "").Respond(http.StatusOK, "")
+	tr.On(http.MethodGet, "/never").Times(0)
+
+	get(t, tr, http.MethodGet, "http://x/once", nil, "")
+	get(t, tr, http.MethodGet, "http://x/twice", nil, "")
+	get(t, tr, http.MethodGet, "http://x/unknown", nil, "")
+
+	tb := &recordingTB{}
+	if tr.AssertExpectations(tb) {
+		t.Fatal("AssertExpectations passed with a missing call and an unexpected request")
+	}
+	if len(tb.errors) != 2 ||
+		!strings.Contains(tb.errors[0], "expected 2 call(s), got 1") ||
+		!strings.Contains(tb.errors[1], "unexpected request GET http://x/unknown") {
+		t.Errorf("reported %q", tb.errors)
+	}
+
+	tr = NewTransport()
+	tr.On(http.MethodGet, "/ok").Times(1)
+	get(t, tr, http.MethodGet, "http://x/ok", nil, "")
+	if !tr.AssertExpectations(&recordingTB{}) {
+		t.Error("AssertExpectations failed with every expectation met")
+	}
+}
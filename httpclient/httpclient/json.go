@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// GetJSON performs a GET request and decodes the JSON response into T
+func GetJSON[T any](c *Client, url string, opts ...RequestOption) (T, error) {
+	return DoJSON[T](c, http.MethodGet, url, nil, opts...)
+}
+
+// PostJSON encodes body as JSON, performs a POST request and decodes the JSON response into Resp
+func PostJSON[Req, Resp any](c *Client, url string, body Req, opts ...RequestOption) (Resp, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		var zero Resp
+		return zero, fmt.Errorf("failed to encode request body: %w", err)
+	}
+	return DoJSON[Resp](c, http.MethodPost, url, data, opts...)
+}
+
+// DoJSON performs a request with an already encoded JSON body and decodes the response into T.
+// Non-2xx responses are returned as *HTTPError
+func DoJSON[T any](c *Client, method, url string, body []byte, opts ...RequestOption) (T, error) {
+	var result T
+	headers := []RequestOption{WithHeader("Accept", "application/json")}
+	if body != nil {
+		headers = append(headers, WithHeader("Content-Type", "application/json"))
+	}
+
+	resp, err := c.Do(method, url, body, append(headers, opts...)...)
+	if err != nil {
+		return result, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, newHTTPError(resp)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent || method == http.MethodHead {
+		return result, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && err != io.EOF {
+		target := ""
+		if resp.Request != nil {
+			target = RedactURL(resp.Request.URL)
+		}
+		return result, fmt.Errorf("failed to decode %s %s response: %w", method, target, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,207 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LimitScope selects whether rate and concurrency limits are shared or kept per host
+type LimitScope int
+
+const (
+	LimitGlobal  LimitScope = iota // one limit shared by all hosts
+	LimitPerHost                   // a separate limit for each request host
+)
+
+// WithRateLimit limits requests to rps per second with bursts of up to burst requests
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(c *Client) error {
+		l := c.limiter()
+		l.rps = rps
+		l.burst = max(burst, 1)
+		return nil
+	}
+}
+
+// WithMaxConcurrent limits the number of requests in flight, counting until the response body is closed
+func WithMaxConcurrent(n int) ClientOption {
+	return func(c *Client) error {
+		c.limiter().maxConcurrent = n
+		return nil
+	}
+}
+
+// WithLimitScope applies the rate and concurrency limits globally or per host
+func WithLimitScope(scope LimitScope) ClientOption {
+	return func(c *Client) error {
+		c.limiter().scope = scope
+		return nil
+	}
+}
+
+// limiter returns the client's limits, creating them on first use
+func (c *Client) limiter() *limits {
+	if c.limits == nil {
+		c.limits = &limits{buckets: make(map[string]*bucket)}
+	}
+	return c.limits
+}
+
+// limits holds the rate and concurrency configuration and one bucket per scope key
+type limits struct {
+	scope         LimitScope
+	rps           float64
+	burst         int
+	maxConcurrent int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket is a token bucket with an optional server-requested pause and a concurrency semaphore
+type bucket struct {
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	slots       chan struct{}
+}
+
+// bucketFor returns the bucket for host according to the scope
+func (l *limits) bucketFor(host string) *bucket {
+	if l.scope == LimitGlobal {
+		host = ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: time.Now()}
+		if l.maxConcurrent > 0 {
+			b.slots = make(chan struct{}, l.maxConcurrent)
+		}
+		l.buckets[host] = b
+	}
+	return b
+}
+
+// wait blocks until a request to host may be sent or ctx is done.
+// The returned release func frees the concurrency slot and must be called once
+func (l *limits) wait(ctx context.Context, host string) (func(), error) {
+	b := l.bucketFor(host)
+	for {
+		delay := b.reserve(l.rps, l.burst)
+		if delay == 0 {
+			break
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case b.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-b.slots }) }, nil
+}
+
+// tryWait is wait without blocking, reporting false if a request to host cannot be sent right away
+func (l *limits) tryWait(host string) (func(), bool) {
+	b := l.bucketFor(host)
+	if b.reserve(l.rps, l.burst) != 0 {
+		return nil, false
+	}
+	if b.slots == nil {
+		return func() {}, true
+	}
+	select {
+	case b.slots <- struct{}{}:
+	default:
+		return nil, false
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-b.slots }) }, true
+}
+
+// reserve takes a token and returns zero, or returns how long to wait before trying again
+func (b *bucket) reserve(rps float64, burst int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if now.Before(b.pausedUntil) {
+		return b.pausedUntil.Sub(now)
+	}
+	if rps <= 0 {
+		return 0
+	}
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rps, float64(burst))
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rps * float64(time.Second))
+}
+
+// adapt pauses host's bucket when the response reports an exhausted quota, for at most limit
+func (l *limits) adapt(host string, resp *http.Response, limit time.Duration) {
+	if resp == nil {
+		return
+	}
+	until, ok := quotaReset(resp)
+	if !ok {
+		return
+	}
+	if latest := time.Now().Add(limit); until.After(latest) {
+		until = latest
+	}
+	b := l.bucketFor(host)
+	b.mu.Lock()
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	b.mu.Unlock()
+}
+
+// quotaReset returns when the server allows requests again, from Retry-After or
+// X-RateLimit-Remaining/X-RateLimit-Reset headers
+func quotaReset(resp *http.Response) (time.Time, bool) {
+	if delay, ok := RetryAfter(resp); ok {
+		return time.Now().Add(delay), true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < 0 {
+		return time.Time{}, false
+	}
+	// Large values are Unix timestamps, small ones are seconds until the reset
+	if reset > 1_000_000_000 {
+		return time.Unix(reset, 0), true
+	}
+	return time.Now().Add(time.Duration(reset) * time.Second), true
+}
+
+// releaseOnClose wraps a response body so release runs when it is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close closes the body and runs the release func
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
@@ -0,0 +1,100 @@
+package httpclient
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sensitiveParams are query parameters whose values are never logged
+var sensitiveParams = []string{"token", "key", "secret", "password", "passwd", "signature", "sig", "auth", "credential"}
+
+// WithLogger sets the logger used to report request attempts; the client is silent by default
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) error {
+		if logger == nil {
+			logger = slog.New(slog.DiscardHandler)
+		}
+		c.logger = logger
+		return nil
+	}
+}
+
+// logAttempt records the outcome of one attempt at a level matching its result
+func (c *Client) logAttempt(req *http.Request, attempt int, resp *http.Response, err error, latency time.Duration, retrying bool) {
+	level := slog.LevelDebug
+	switch {
+	case retrying:
+		level = slog.LevelWarn
+	case err != nil || resp.StatusCode >= 500:
+		level = slog.LevelError
+	case resp.StatusCode >= 400:
+		level = slog.LevelInfo
+	}
+	ctx := req.Context()
+	if !c.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", RedactURL(req.URL)),
+		slog.Int("attempt", attempt+1),
+		slog.Duration("latency", latency),
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	msg := "http request"
+	if retrying {
+		msg = "http request failed, retrying"
+	}
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// redactError hides secrets in the URL that a *url.Error from the transport repeats
+func redactError(err error) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	if u, perr := url.Parse(ue.URL); perr == nil {
+		ue.URL = RedactURL(u)
+	}
+	return err
+}
+
+// RedactURL returns the URL as a string with its password and sensitive query values hidden
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if redacted.RawQuery != "" {
+		q := redacted.Query()
+		for name := range q {
+			if isSensitiveParam(name) {
+				q[name] = []string{"REDACTED"}
+			}
+		}
+		redacted.RawQuery = q.Encode()
+	}
+	return redacted.Redacted()
+}
+
+// isSensitiveParam reports whether a query parameter name looks like it carries a secret
+func isSensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveParams {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
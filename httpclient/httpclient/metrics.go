@@ -0,0 +1,102 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// Metrics receives request measurements so they can be exported to any metrics backend.
+// Status is 0 when the attempt failed without a response
+type Metrics interface {
+	// IncRequests counts one attempt sent to host
+	IncRequests(method, host string, status int)
+	// ObserveLatency records how long one attempt took, for a latency histogram
+	ObserveLatency(method, host string, status int, latency time.Duration)
+	// IncRetries counts one retry scheduled for host
+	IncRetries(method, host string)
+}
+
+// WithMetrics sets the recorder for request counts, latencies and retries
+func WithMetrics(metrics Metrics) ClientOption {
+	return func(c *Client) error {
+		if metrics == nil {
+			metrics = NoopMetrics{}
+		}
+		c.metrics = metrics
+		return nil
+	}
+}
+
+// NoopMetrics discards all measurements
+type NoopMetrics struct{}
+
+func (NoopMetrics) IncRequests(method, host string, status int)                           {}
+func (NoopMetrics) ObserveLatency(method, host string, status int, latency time.Duration) {}
+func (NoopMetrics) IncRetries(method, host string)                                        {}
+
+// MetricKey identifies a series recorded by InMemoryMetrics
+type MetricKey struct {
+	Method string
+	Host   string
+	Status int
+}
+
+// InMemoryMetrics keeps all measurements in memory, intended for tests
+type InMemoryMetrics struct {
+	mu        sync.Mutex
+	requests  map[MetricKey]int
+	latencies map[MetricKey][]time.Duration
+	retries   map[MetricKey]int
+}
+
+// NewInMemoryMetrics creates an empty InMemoryMetrics
+func NewInMemoryMetrics() *InMemoryMetrics {
+	return &InMemoryMetrics{
+		requests:  make(map[MetricKey]int),
+		latencies: make(map[MetricKey][]time.Duration),
+		retries:   make(map[MetricKey]int),
+	}
+}
+
+// IncRequests counts one attempt
+func (m *InMemoryMetrics) IncRequests(method, host string, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[MetricKey{method, host, status}]++
+}
+
+// ObserveLatency stores one latency sample
+func (m *InMemoryMetrics) ObserveLatency(method, host string, status int, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := MetricKey{method, host, status}
+	m.latencies[key] = append(m.latencies[key], latency)
+}
+
+// IncRetries counts one retry
+func (m *InMemoryMetrics) IncRetries(method, host string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries[MetricKey{Method: method, Host: host}]++
+}
+
+// Requests returns the number of attempts recorded for the key
+func (m *InMemoryMetrics) Requests(key MetricKey) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests[key]
+}
+
+// Latencies returns the latency samples recorded for the key
+func (m *InMemoryMetrics) Latencies(key MetricKey) []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Duration(nil), m.latencies[key]...)
+}
+
+// Retries returns the number of retries recorded for method and host
+func (m *InMemoryMetrics) Retries(method, host string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.retries[MetricKey{Method: method, Host: host}]
+}
@@ -0,0 +1,32 @@
+package httpclient
+
+import "net/http"
+
+// Middleware wraps the next http.RoundTripper, e.g. to add auth, logging, metrics or tracing
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to the http.RoundTripper interface
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware appends middleware around the client's transport.
+// The first middleware is the outermost one. Middleware sits below the retry
+// loop, so it runs once per attempt and sees every retry as a separate request
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *Client) error {
+		c.middlewares = append(c.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// chain wraps rt with the middlewares so the first one runs first
+func chain(rt http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		rt = middlewares[i](rt)
+	}
+	return rt
+}
@@ -0,0 +1,184 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryDelta is how long before its expiry a token is treated as expired
+const expiryDelta = 10 * time.Second
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time // zero if the token does not expire
+}
+
+// Type returns the token type for the Authorization header, Bearer by default
+func (t *Token) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// Valid reports whether the token is set and not about to expire
+func (t *Token) Valid() bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry))
+}
+
+// TokenSource supplies access tokens
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// WithTokenSource authorizes every request without an Authorization header with a token
+// from ts. Tokens are cached until they expire, and a 401 response is retried once
+// with a fresh token
+func WithTokenSource(ts TokenSource) ClientOption {
+	return func(c *Client) error {
+		c.tokens = &cachingTokenSource{source: ts}
+		return nil
+	}
+}
+
+// cachingTokenSource caches a token and refreshes it with a single concurrent call
+type cachingTokenSource struct {
+	source TokenSource
+	mu     sync.Mutex
+	token  *Token
+}
+
+// Token returns the cached token or fetches a new one; concurrent callers wait for the same fetch
+func (s *cachingTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	token, err := s.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// invalidate drops the cached token if it is still the rejected one
+func (s *cachingTokenSource) invalidate(rejected *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == rejected {
+		s.token = nil
+	}
+}
+
+// ClientCredentials obtains tokens with the OAuth2 client credentials grant
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Client sends the token requests; it must not use this token source itself. Nil uses New()
+	Client *Client
+}
+
+// Token requests a new token from the token endpoint
+func (cc *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	values := url.Values{"grant_type": {"client_credentials"}}
+	if len(cc.Scopes) > 0 {
+		values.Set("scope", strings.Join(cc.Scopes, " "))
+	}
+	return requestToken(ctx, cc.Client, cc.TokenURL, cc.ClientID, cc.ClientSecret, values)
+}
+
+// RefreshToken obtains tokens with the OAuth2 refresh token grant, keeping any
+// rotated refresh token returned by the server
+type RefreshToken struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// Client sends the token requests; it must not use this token source itself. Nil uses New()
+	Client *Client
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+// NewRefreshToken creates a RefreshToken source starting from refreshToken
+func NewRefreshToken(tokenURL, clientID, clientSecret, refreshToken string, client *Client) *RefreshToken {
+	return &RefreshToken{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Client:       client,
+		refreshToken: refreshToken,
+	}
+}
+
+// Token exchanges the refresh token for a new access token
+func (rt *RefreshToken) Token(ctx context.Context) (*Token, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	values := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {rt.refreshToken}}
+	token, err := requestToken(ctx, rt.Client, rt.TokenURL, rt.ClientID, rt.ClientSecret, values)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" {
+		rt.refreshToken = token.RefreshToken
+	}
+	return token, nil
+}
+
+// tokenResponse is the JSON body returned by a token endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// requestToken posts a grant to the token endpoint and decodes the token
+func requestToken(ctx context.Context, c *Client, tokenURL, clientID, clientSecret string, values url.Values) (*Token, error) {
+	if c == nil {
+		c = New()
+	}
+	opts := []RequestOption{
+		WithContext(ctx),
+		WithForm(values),
+		WithHeader("Accept", "application/json"),
+	}
+	if clientID != "" {
+		opts = append(opts, WithBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret)))
+	}
+	resp, err := c.Post(tokenURL, nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	if NonSuccess(resp.StatusCode) {
+		return nil, fmt.Errorf("token request failed: %w", newHTTPError(resp))
+	}
+	defer resp.Body.Close()
+
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+	token := &Token{AccessToken: tr.AccessToken, TokenType: tr.TokenType, RefreshToken: tr.RefreshToken}
+	if tr.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
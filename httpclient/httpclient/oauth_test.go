@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"http-client-example/httpclient/httpclienttest"
+)
+
+func TestTokenRefreshOn401(t *testing.T) {
+	ts := httpclienttest.NewTokenServer("app", "s3cret")
+	defer ts.Close()
+	var seen []string
+	api := httptest.NewServer(ts.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	})))
+	defer api.Close()
+
+	c, err := NewClient(WithTokenSource(&ClientCredentials{TokenURL: ts.TokenURL(), ClientID: "app", ClientSecret: "s3cret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() {
+		t.Helper()
+		resp, err := c.Get(api.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+	}
+
+	get()
+	get()
+	if ts.Issued() != 1 {
+		t.Errorf("issued %d tokens, want the first one reused", ts.Issued())
+	}
+	ts.Revoke(seen[len(seen)-1])
+	get()
+	if ts.Issued() != 2 || len(seen) != 3 || seen[2] == seen[0] {
+		t.Errorf("issued %d tokens, requests used %v; want a new token after the 401", ts.Issued(), seen)
+	}
+}
@@ -0,0 +1,266 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrTooManyPages is yielded when pagination stops at the max-pages guard
+var ErrTooManyPages = errors.New("pagination stopped at the maximum number of pages")
+
+// DefaultMaxPages is the max-pages guard used when Paginate is given zero
+const DefaultMaxPages = 1000
+
+// PageStrategy describes how a paginated API exposes its items and next page
+type PageStrategy interface {
+	// First adjusts the URL of the first page, e.g. to set the page size
+	First(u *url.URL)
+	// Page extracts the raw items of a page and the URL of the next one, empty on the last page
+	Page(resp *http.Response, body []byte) (items []json.RawMessage, next string, err error)
+}
+
+// Paginate fetches pages with GET starting at url and iterates over their items decoded as T.
+// Iteration stops when the strategy reports no next page, the consumer stops, the request
+// context is done, a request fails, or after maxPages pages (DefaultMaxPages if zero), in which
+// case ErrTooManyPages is yielded. opts are applied to every page request, so query parameters
+// belong in url rather than in options
+func Paginate[T any](c *Client, url string, strategy PageStrategy, maxPages int, opts ...RequestOption) iter.Seq2[T, error] {
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+	return func(yield func(T, error) bool) {
+		var zero T
+		next := url
+		for page := 0; next != ""; page++ {
+			if page >= maxPages {
+				yield(zero, fmt.Errorf("%w (%d)", ErrTooManyPages, maxPages))
+				return
+			}
+			pageOpts := opts
+			if page == 0 {
+				pageOpts = append([]RequestOption{func(req *http.Request) error {
+					strategy.First(req.URL)
+					return nil
+				}}, opts...)
+			}
+
+			items, nextURL, err := fetchPage(c, next, strategy, pageOpts)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, raw := range items {
+				var item T
+				if err := json.Unmarshal(raw, &item); err != nil {
+					yield(zero, fmt.Errorf("failed to decode page item: %w", err))
+					return
+				}
+				if !yield(item, nil) {
+					return
+				}
+			}
+			next = nextURL
+		}
+	}
+}
+
+// fetchPage requests one page and lets the strategy parse it
+func fetchPage(c *Client, pageURL string, strategy PageStrategy, opts []RequestOption) ([]json.RawMessage, string, error) {
+	resp, err := c.Get(pageURL, append([]RequestOption{WithHeader("Accept", "application/json")}, opts...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	if NonSuccess(resp.StatusCode) {
+		return nil, "", newHTTPError(resp)
+	}
+	body, err := ReadBody(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read page: %w", err)
+	}
+	return strategy.Page(resp, body)
+}
+
+// LinkHeader follows the RFC 5988 Link header with rel="next". Items are read from
+// itemsField, a dot-separated path into the JSON body, or from the body itself if empty
+func LinkHeader(itemsField string) PageStrategy {
+	return &linkHeader{itemsField: itemsField}
+}
+
+// linkHeader implements Link header pagination
+type linkHeader struct {
+	itemsField string
+}
+
+// First leaves the URL unchanged
+func (s *linkHeader) First(*url.URL) {}
+
+// Page returns the items and the resolved rel="next" link
+func (s *linkHeader) Page(resp *http.Response, body []byte) ([]json.RawMessage, string, error) {
+	items, err := jsonItems(body, s.itemsField)
+	if err != nil {
+		return nil, "", err
+	}
+	next := nextLink(resp.Header.Values("Link"))
+	if next == "" {
+		return items, "", nil
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid next link %q: %w", next, err)
+	}
+	return items, resp.Request.URL.ResolveReference(ref).String(), nil
+}
+
+// Cursor reads the next cursor from cursorField and sends it back in the query parameter
+// param. Items are read from itemsField; both fields are dot-separated paths into the JSON body.
+// A missing, null or empty cursor ends pagination
+func Cursor(itemsField, cursorField, param string) PageStrategy {
+	return &cursor{itemsField: itemsField, cursorField: cursorField, param: param}
+}
+
+// cursor implements cursor pagination
+type cursor struct {
+	itemsField  string
+	cursorField string
+	param       string
+}
+
+// First leaves the URL unchanged
+func (s *cursor) First(*url.URL) {}
+
+// Page returns the items and the current URL with the next cursor
+func (s *cursor) Page(resp *http.Response, body []byte) ([]json.RawMessage, string, error) {
+	items, err := jsonItems(body, s.itemsField)
+	if err != nil {
+		return nil, "", err
+	}
+	raw, err := jsonField(body, s.cursorField)
+	if err != nil || raw == nil {
+		return items, "", nil
+	}
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, "", fmt.Errorf("invalid cursor: %w", err)
+	}
+	var next string
+	switch v := value.(type) {
+	case string:
+		next = v
+	case float64:
+		next = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if next == "" {
+		return items, "", nil
+	}
+	return items, withParam(resp.Request.URL, s.param, next), nil
+}
+
+// Offset pages with offset and limit query parameters, requesting limit items at a time
+// and stopping at the first short page. Items are read from itemsField as in LinkHeader
+func Offset(offsetParam, limitParam string, limit int, itemsField string) PageStrategy {
+	return &offset{offsetParam: offsetParam, limitParam: limitParam, limit: limit, itemsField: itemsField}
+}
+
+// offset implements offset/limit pagination
+type offset struct {
+	offsetParam string
+	limitParam  string
+	limit       int
+	itemsField  string
+}
+
+// First sets the limit and a zero offset
+func (s *offset) First(u *url.URL) {
+	q := u.Query()
+	q.Set(s.limitParam, strconv.Itoa(s.limit))
+	q.Set(s.offsetParam, "0")
+	u.RawQuery = q.Encode()
+}
+
+// Page returns the items and the URL of the following offset
+func (s *offset) Page(resp *http.Response, body []byte) ([]json.RawMessage, string, error) {
+	items, err := jsonItems(body, s.itemsField)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(items) == 0 || len(items) < s.limit {
+		return items, "", nil
+	}
+	current, _ := strconv.Atoi(resp.Request.URL.Query().Get(s.offsetParam))
+	return items, withParam(resp.Request.URL, s.offsetParam, strconv.Itoa(current+len(items))), nil
+}
+
+// withParam returns u with the query parameter set to value
+func withParam(u *url.URL, name, value string) string {
+	next := *u
+	q := next.Query()
+	q.Set(name, value)
+	next.RawQuery = q.Encode()
+	return next.String()
+}
+
+// nextLink returns the target of the rel="next" link in Link header values
+func nextLink(values []string) string {
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			target, params, _ := strings.Cut(strings.TrimSpace(link), ";")
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, rel, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") {
+					continue
+				}
+				for _, r := range strings.Fields(strings.Trim(rel, `"`)) {
+					if strings.EqualFold(r, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// jsonItems decodes the array found at path in body
+func jsonItems(body []byte, path string) ([]json.RawMessage, error) {
+	raw, err := jsonField(body, path)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("page items at %q are not an array: %w", path, err)
+	}
+	return items, nil
+}
+
+// jsonField returns the raw value at a dot-separated path, nil if it is missing or null
+func jsonField(body []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(body)
+	if path == "" {
+		return raw, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("failed to decode page: %w", err)
+		}
+		var ok bool
+		if raw, ok = obj[key]; !ok || string(raw) == "null" {
+			return nil, nil
+		}
+	}
+	return raw, nil
+}
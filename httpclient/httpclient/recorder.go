@@ -0,0 +1,303 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrNoInteraction is returned in replay mode when no recorded interaction matches a request
+var ErrNoInteraction = errors.New("no recorded interaction matches request")
+
+// RecorderMode selects how the recorder uses its cassette
+type RecorderMode int
+
+const (
+	ModeReplay         RecorderMode = iota // answer only from the cassette, never touch the network
+	ModeRecord                             // send every request and overwrite the cassette
+	ModeReplayOrRecord                     // replay matching interactions and record the rest
+)
+
+// Matcher reports whether a live request corresponds to a recorded one
+type Matcher func(req *http.Request, body []byte, recorded CassetteRequest) bool
+
+// MatchMethod matches on the request method
+func MatchMethod(req *http.Request, body []byte, recorded CassetteRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL matches on the full request URL
+func MatchURL(req *http.Request, body []byte, recorded CassetteRequest) bool {
+	return req.URL.String() == recorded.URL
+}
+
+// MatchBody matches on the exact request body
+func MatchBody(req *http.Request, body []byte, recorded CassetteRequest) bool {
+	recordedBody, err := recorded.Body.bytes()
+	return err == nil && bytes.Equal(body, recordedBody)
+}
+
+// MatchHeader returns a Matcher comparing the given request header
+func MatchHeader(name string) Matcher {
+	return func(req *http.Request, body []byte, recorded CassetteRequest) bool {
+		return req.Header.Get(name) == http.Header(recorded.Header).Get(name)
+	}
+}
+
+// Cassette is the on-disk JSON document holding recorded interactions
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request/response pair
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is the recorded form of a request
+type CassetteRequest struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Header map[string][]string `json:"header,omitempty"`
+	Body   CassetteBody        `json:"body"`
+}
+
+// CassetteResponse is the recorded form of a response
+type CassetteResponse struct {
+	StatusCode int                 `json:"status_code"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       CassetteBody        `json:"body"`
+}
+
+// CassetteBody stores a body as text, or as base64 when it is not valid UTF-8
+type CassetteBody struct {
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// newCassetteBody encodes data for storage
+func newCassetteBody(data []byte) CassetteBody {
+	if utf8.Valid(data) {
+		return CassetteBody{Text: string(data)}
+	}
+	return CassetteBody{Text: base64.StdEncoding.EncodeToString(data), Encoding: "base64"}
+}
+
+// bytes decodes the stored body
+func (b CassetteBody) bytes() ([]byte, error) {
+	if b.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Text)
+	}
+	return []byte(b.Text), nil
+}
+
+// RecorderOption configures the recorder
+type RecorderOption func(*recorder)
+
+// WithMatchers replaces the default method and URL matching; all matchers must agree
+func WithMatchers(matchers ...Matcher) RecorderOption {
+	return func(r *recorder) {
+		r.matchers = matchers
+	}
+}
+
+// WithRedactedHeaders adds headers whose values are replaced before an interaction is saved.
+// Authorization, Proxy-Authorization, Cookie and Set-Cookie are always redacted
+func WithRedactedHeaders(names ...string) RecorderOption {
+	return func(r *recorder) {
+		r.redact = append(r.redact, names...)
+	}
+}
+
+// WithRecorder records request/response pairs to a JSON cassette at path, or replays them
+// from it, so tests against real APIs can run offline
+func WithRecorder(path string, mode RecorderMode, opts ...RecorderOption) ClientOption {
+	return func(c *Client) error {
+		r := &recorder{
+			path:     path,
+			mode:     mode,
+			matchers: []Matcher{MatchMethod, MatchURL},
+			redact:   []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+		}
+		for _, opt := range opts {
+			opt(r)
+		}
+		if mode != ModeRecord {
+			data, err := os.ReadFile(path)
+			switch {
+			case err == nil:
+				if err := json.Unmarshal(data, &r.cassette); err != nil {
+					return fmt.Errorf("failed to parse cassette %s: %w", path, err)
+				}
+			case errors.Is(err, os.ErrNotExist) && mode == ModeReplayOrRecord:
+			default:
+				return fmt.Errorf("failed to read cassette: %w", err)
+			}
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+		c.recorder = r
+		return nil
+	}
+}
+
+// recorder is the RoundTripper that records to and replays from a cassette
+type recorder struct {
+	path     string
+	mode     RecorderMode
+	matchers []Matcher
+	redact   []string
+	next     http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// RoundTrip replays a matching interaction or sends the request and records it
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode != ModeRecord {
+		if resp, ok, err := r.replay(req, body); ok || err != nil {
+			return resp, err
+		}
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("%s %s: %w", req.Method, RedactURL(req.URL), ErrNoInteraction)
+		}
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if err := r.record(req, body, resp, respBody); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replay returns the first unused matching interaction, or the first match if all were used
+func (r *recorder) replay(req *http.Request, body []byte) (*http.Response, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := -1
+	for i, in := range r.cassette.Interactions {
+		if !r.matches(req, body, in.Request) {
+			continue
+		}
+		if !r.used[i] {
+			found = i
+			break
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return nil, false, nil
+	}
+	r.used[found] = true
+
+	recorded := r.cassette.Interactions[found].Response
+	data, err := recorded.Body.bytes()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode recorded body: %w", err)
+	}
+	return &http.Response{
+		StatusCode:    recorded.StatusCode,
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(recorded.Header).Clone(),
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, true, nil
+}
+
+// matches reports whether every matcher accepts the recorded request
+func (r *recorder) matches(req *http.Request, body []byte, recorded CassetteRequest) bool {
+	for _, m := range r.matchers {
+		if !m(req, body, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// record appends an interaction with secrets redacted and saves the cassette
+func (r *recorder) record(req *http.Request, body []byte, resp *http.Response, respBody []byte) error {
+	in := Interaction{
+		Request: CassetteRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: r.redactHeader(req.Header),
+			Body:   newCassetteBody(body),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.redactHeader(resp.Header),
+			Body:       newCassetteBody(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	r.used = append(r.used, true)
+	return r.save()
+}
+
+// redactHeader copies h replacing the values of redacted headers
+func (r *recorder) redactHeader(h http.Header) map[string][]string {
+	out := h.Clone()
+	for _, name := range r.redact {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out.Set(name, "REDACTED")
+		}
+	}
+	return out
+}
+
+// save writes the cassette atomically
+func (r *recorder) save() error {
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -1,7 +1,10 @@
 package httpclient
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 )
 
@@ -26,6 +29,27 @@ func WithQueryParam(key, value string) RequestOption {
 	}
 }
 
+// WithPathParams replaces {name} placeholders in the request path with escaped values,
+// e.g. Get("/users/{id}/posts", WithPathParams(map[string]string{"id": "42"}))
+func WithPathParams(params map[string]string) RequestOption {
+	return func(req *http.Request) error {
+		return expandPath(req.URL, params)
+	}
+}
+
+// WithQuery adds query parameters from a struct with `url:"name,omitempty"` tags,
+// url.Values or a map[string]string. Slices become repeated parameters
+func WithQuery(v any) RequestOption {
+	return func(req *http.Request) error {
+		q := req.URL.Query()
+		if err := encodeQuery(q, v); err != nil {
+			return err
+		}
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
+
 // WithContext sets a context for the request
 func WithContext(ctx context.Context) RequestOption {
 	return func(req *http.Request) error {
@@ -41,3 +65,41 @@ func WithBasicAuth(username, password string) RequestOption {
 		return nil
 	}
 }
+
+// WithBufferedBody reads the request body into memory so it can be replayed on retry
+func WithBufferedBody() RequestOption {
+	return func(req *http.Request) error {
+		if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+			return nil
+		}
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to buffer request body: %w", err)
+		}
+		req.ContentLength = int64(len(data))
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		return nil
+	}
+}
+
+// WithBodyFactory sets a body that is rebuilt by calling newBody for every attempt,
+// e.g. by reopening a file, so large payloads can be retried without buffering
+func WithBodyFactory(newBody func() (io.ReadCloser, error), contentLength int64) RequestOption {
+	return func(req *http.Request) error {
+		body, err := newBody()
+		if err != nil {
+			return fmt.Errorf("failed to create request body: %w", err)
+		}
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		req.Body = body
+		req.GetBody = newBody
+		req.ContentLength = contentLength
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides whether a failed attempt is retried and how long to wait before the next one
+type RetryPolicy interface {
+	// ShouldRetry reports whether the attempt (starting at 0) that produced resp or err should be retried
+	ShouldRetry(resp *http.Response, err error, attempt int) bool
+	// Backoff returns the delay before the attempt following the given one
+	Backoff(attempt int) time.Duration
+}
+
+// ExponentialBackoff retries transport errors, 429 and 5xx responses with
+// exponentially growing delays and full jitter
+type ExponentialBackoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when no other is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return &ExponentialBackoff{BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+}
+
+// ShouldRetry retries transport errors and retryable status codes
+func (p *ExponentialBackoff) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	return isRetryable(resp, err)
+}
+
+// Backoff returns a random delay between zero and BaseDelay*2^attempt, capped at MaxDelay when set
+func (p *ExponentialBackoff) Backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 0; i < attempt && ceiling > 0 && (p.MaxDelay <= 0 || ceiling < p.MaxDelay); i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && (ceiling > p.MaxDelay || ceiling < 0) {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// ConstantBackoff retries the same failures as ExponentialBackoff with a fixed delay
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+// ShouldRetry retries transport errors and retryable status codes
+func (p *ConstantBackoff) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	return isRetryable(resp, err)
+}
+
+// Backoff returns the configured interval
+func (p *ConstantBackoff) Backoff(attempt int) time.Duration {
+	return p.Interval
+}
+
+// WithRetryPolicy sets the policy that decides which failures are retried and how long to wait
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		c.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithRetryNonIdempotent allows retrying requests such as POST that carry no Idempotency-Key
+func WithRetryNonIdempotent() ClientOption {
+	return func(c *Client) error {
+		c.retryNonIdempotent = true
+		return nil
+	}
+}
+
+// WithRetryBudget limits the total time spent on a request including all retries.
+// An attempt still waiting for its response when the budget runs out is cancelled, and no
+// further attempt is made once the next wait would exceed the budget. The budget stops
+// once a response is returned, so reading its body is bounded only by the request context
+func WithRetryBudget(budget time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.retryBudget = budget
+		return nil
+	}
+}
+
+// DefaultMaxRetryAfter is the longest Retry-After a client waits for unless WithMaxRetryAfter changes it
+const DefaultMaxRetryAfter = 5 * time.Minute
+
+// WithMaxRetryAfter sets the longest server-requested wait that is honoured. A retry that
+// the server asks to delay for longer is not attempted, and rate limit pauses are capped at it
+func WithMaxRetryAfter(limit time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.maxRetryAfter = limit
+		return nil
+	}
+}
+
+// isRetryable reports whether an attempt failed in a way that is worth retrying
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrNoInteraction)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return resp.StatusCode >= 500
+}
+
+// IsIdempotent reports whether a request can safely be sent more than once,
+// either because of its method or because it carries an Idempotency-Key header
+func IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// RetryAfter returns the delay requested by a 429 or 503 response's Retry-After header
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// retryDelay returns how long to wait after the given attempt, preferring the server's
+// Retry-After, and false if the server asks for longer than the client is willing to wait
+func (c *Client) retryDelay(resp *http.Response, attempt int) (time.Duration, bool) {
+	if delay, ok := RetryAfter(resp); ok {
+		return delay, delay <= c.maxRetryAfter
+	}
+	return c.retryPolicy.Backoff(attempt), true
+}
+
+// sleepContext waits for the given delay or until ctx is done, returning the context error in that case
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
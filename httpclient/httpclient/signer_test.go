@@ -0,0 +1,179 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sigV4Time is the signing time used throughout the AWS SigV4 test suite
+var sigV4Time = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+func TestSigV4Signer(t *testing.T) {
+	signer := &SigV4Signer{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+		Now:             func() time.Time { return sigV4Time },
+	}
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:   "get-vanilla",
+			method: http.MethodGet,
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: http.MethodGet,
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:        "post-x-www-form-urlencoded",
+			method:      http.MethodPost,
+			url:         "https://example.amazonaws.com/",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "Param1=value1",
+			want:        "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if err := signer.Sign(req); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q", got)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	signer := &HMACSigner{
+		KeyID:  "key-1",
+		Secret: []byte("secret"),
+		Now:    func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://api.example.com/v1/items?b=two%20words&a=1", strings.NewReader(`{"name":"widget"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"X-Key-Id":         "key-1",
+		"X-Timestamp":      "2024-01-02T03:04:05Z",
+		"X-Content-SHA256": "256e2b36195d6c9d25b78bf0df70019cb60421b088cf96ca21e570fbfc34f6b2",
+		"X-Signature":      "db0ef73f5e687e90e9e96083b5211d91b370de6be78ca8ba3c18dcf701e77599",
+	}
+	for name, value := range want {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestSignerUnreplayableMultipart(t *testing.T) {
+	var hits int
+	var gotHeader http.Header
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		gotHeader = r.Header
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse multipart: %v", err)
+			return
+		}
+		f, _, err := r.FormFile("f")
+		if err != nil {
+			t.Errorf("form file: %v", err)
+			return
+		}
+		defer f.Close()
+		b, _ := io.ReadAll(f)
+		gotBody = string(b)
+	}))
+	defer srv.Close()
+
+	sigV4 := func(service string) Signer {
+		return &SigV4Signer{AccessKeyID: "AKID", SecretAccessKey: "secret", Region: "us-east-1", Service: service}
+	}
+	tests := []struct {
+		name     string
+		signer   Signer
+		seekable bool
+		header   string // header carrying the payload hash
+		wantHash string // empty if signing must fail
+	}{
+		{"hmac", &HMACSigner{KeyID: "k", Secret: []byte("s")}, false, "X-Content-SHA256", ""},
+		{"hmac opt-in", &HMACSigner{KeyID: "k", Secret: []byte("s"), AllowUnsignedPayload: true}, false, "X-Content-SHA256", UnsignedPayload},
+		{"hmac seekable", &HMACSigner{KeyID: "k", Secret: []byte("s")}, true, "X-Content-SHA256", "hashed"},
+		{"sigv4", sigV4("execute-api"), false, "X-Amz-Content-Sha256", ""},
+		{"sigv4 s3", sigV4("s3"), false, "X-Amz-Content-Sha256", UnsignedPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, gotHeader, gotBody = 0, nil, ""
+			c, err := NewClient(WithRetry(0, 0), WithSigner(tt.signer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A bare io.Reader cannot seek, so its form can only be read once
+			var file io.Reader = io.MultiReader(strings.NewReader("hello"))
+			if tt.seekable {
+				file = strings.NewReader("hello")
+			}
+			resp, err := c.PostStream(srv.URL, nil, WithMultipart(NewMultipartForm().Reader("f", "f.txt", file)))
+			if tt.wantHash == "" {
+				if !errors.Is(err, ErrBodyNotReplayable) || hits != 0 {
+					t.Errorf("err = %v after %d requests, want %v before sending", err, hits, ErrBodyNotReplayable)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			got := gotHeader.Get(tt.header)
+			if tt.wantHash == "hashed" {
+				if len(got) != 64 {
+					t.Errorf("%s = %q, want a SHA-256 hash", tt.header, got)
+				}
+			} else if got != tt.wantHash {
+				t.Errorf("%s = %q, want %q", tt.header, got, tt.wantHash)
+			}
+			if gotBody != "hello" {
+				t.Errorf("file part = %q, want %q", gotBody, "hello")
+			}
+		})
+	}
+}
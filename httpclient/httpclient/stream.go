@@ -0,0 +1,223 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostStream performs a POST request whose body is streamed from an io.Reader
+func (c *Client) PostStream(url string, body io.Reader, opts ...RequestOption) (*http.Response, error) {
+	return c.DoStream(http.MethodPost, url, body, opts...)
+}
+
+// NDJSON iterates over the newline-delimited JSON records of resp's body and
+// closes it when iteration stops. Blank lines are skipped
+func NDJSON[T any](resp *http.Response) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer resp.Body.Close()
+		r := bufio.NewReader(resp.Body)
+		for {
+			line, err := r.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				var record T
+				if derr := json.Unmarshal(line, &record); derr != nil {
+					yield(record, fmt.Errorf("failed to decode NDJSON record: %w", derr))
+					return
+				}
+				if !yield(record, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+		}
+	}
+}
+
+// GetNDJSON performs a GET request and iterates over the NDJSON records of the response.
+// A failed request or non-2xx response is yielded as the only error
+func GetNDJSON[T any](c *Client, url string, opts ...RequestOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		opts = append([]RequestOption{WithHeader("Accept", "application/x-ndjson")}, opts...)
+		resp, err := c.Get(url, opts...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		if NonSuccess(resp.StatusCode) {
+			yield(zero, newHTTPError(resp))
+			return
+		}
+		for record, err := range NDJSON[T](resp) {
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+}
+
+// Event is a Server-Sent Event
+type Event struct {
+	ID    string
+	Event string // "message" unless the server names the event type
+	Data  string
+	Retry time.Duration // reconnection delay requested by the server, if any
+}
+
+// Events subscribes to a Server-Sent Events stream and iterates over its events.
+// When the stream ends or fails it reconnects with the Last-Event-ID header, waiting
+// for the server's retry delay or the client's backoff, and gives up after the
+// configured number of consecutive failed reconnects or when ctx is done
+func (c *Client) Events(ctx context.Context, url string, opts ...RequestOption) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		var lastID string
+		var serverRetry time.Duration
+		failures := 0
+		for {
+			reqOpts := append([]RequestOption{
+				WithContext(ctx),
+				WithHeader("Accept", "text/event-stream"),
+				WithHeader("Cache-Control", "no-cache"),
+			}, opts...)
+			if lastID != "" {
+				reqOpts = append(reqOpts, WithHeader("Last-Event-ID", lastID))
+			}
+
+			resp, err := c.Get(url, reqOpts...)
+			switch {
+			case err != nil:
+			case resp.StatusCode == http.StatusNoContent:
+				resp.Body.Close()
+				return
+			case NonSuccess(resp.StatusCode):
+				yield(Event{}, newHTTPError(resp))
+				return
+			default:
+				received := false
+				for event, serr := range readEvents(resp.Body) {
+					if serr != nil {
+						err = serr
+						break
+					}
+					received = true
+					if event.ID != "" {
+						lastID = event.ID
+					}
+					if event.Retry > 0 {
+						serverRetry = event.Retry
+					}
+					if event.Data == "" {
+						continue
+					}
+					if !yield(event, nil) {
+						resp.Body.Close()
+						return
+					}
+				}
+				resp.Body.Close()
+				if received {
+					failures = 0
+				}
+			}
+
+			if ctx.Err() != nil {
+				yield(Event{}, ctx.Err())
+				return
+			}
+			if failures >= c.retries {
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				yield(Event{}, fmt.Errorf("event stream failed after %d reconnects: %w", failures, err))
+				return
+			}
+			delay := serverRetry
+			if delay == 0 {
+				delay = c.retryPolicy.Backoff(failures)
+			}
+			failures++
+			if err := sleepContext(ctx, delay); err != nil {
+				yield(Event{}, err)
+				return
+			}
+		}
+	}
+}
+
+// readEvents parses an event stream. Events that only set id or retry are yielded
+// with empty Data so the caller can track them
+func readEvents(body io.Reader) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		r := bufio.NewReader(body)
+		var event Event
+		var data strings.Builder
+		pending := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil && !(err == io.EOF && line != "") {
+				if errors.Is(err, io.EOF) {
+					return
+				}
+				yield(Event{}, err)
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+
+			if line == "" {
+				if pending {
+					event.Data = strings.TrimSuffix(data.String(), "\n")
+					if event.Data != "" && event.Event == "" {
+						event.Event = "message"
+					}
+					if !yield(event, nil) {
+						return
+					}
+				}
+				event, pending = Event{}, false
+				data.Reset()
+				continue
+			}
+			if strings.HasPrefix(line, ":") {
+				continue
+			}
+
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event.Event = value
+			case "data":
+				data.WriteString(value)
+				data.WriteByte('\n')
+			case "id":
+				if !strings.Contains(value, "\x00") {
+					event.ID = value
+				}
+			case "retry":
+				if ms, perr := strconv.Atoi(value); perr == nil && ms >= 0 {
+					event.Retry = time.Duration(ms) * time.Millisecond
+				}
+			default:
+				continue
+			}
+			pending = true
+		}
+	}
+}
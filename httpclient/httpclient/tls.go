@@ -0,0 +1,317 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrPinMismatch is returned when no certificate presented by the server matches a configured SPKI pin
+var ErrPinMismatch = errors.New("server certificate does not match any SPKI pin")
+
+// WithTLSPEM sets up TLS from in-memory PEM data. certPEM and keyPEM may be nil to
+// only trust caPEM, and caPEM may be nil to keep the system roots
+func WithTLSPEM(certPEM, keyPEM, caPEM []byte) ClientOption {
+	return func(c *Client) error {
+		cfg := c.tls()
+		if certPEM != nil || keyPEM != nil {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return fmt.Errorf("failed to parse client cert: %w", err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		if caPEM != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caPEM) {
+				return errors.New("failed to parse CA certificates")
+			}
+			cfg.RootCAs = pool
+		}
+		return nil
+	}
+}
+
+// WithClientCertificate supplies the client certificate through a callback on every handshake
+func WithClientCertificate(get func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) ClientOption {
+	return func(c *Client) error {
+		c.tls().GetClientCertificate = get
+		return nil
+	}
+}
+
+// WithRootCAsFunc verifies servers against the pool returned by roots on every handshake,
+// so the trusted CAs can change without rebuilding the client
+func WithRootCAsFunc(roots func() *x509.CertPool) ClientOption {
+	return func(c *Client) error {
+		c.tls()
+		c.tlsRoots = roots
+		return nil
+	}
+}
+
+// WithSPKIPins requires a certificate in the server's chain to match one of the
+// base64-encoded SHA-256 hashes of its SubjectPublicKeyInfo
+func WithSPKIPins(pins ...string) ClientOption {
+	return func(c *Client) error {
+		c.tls()
+		c.spkiPins = append(c.spkiPins, pins...)
+		return nil
+	}
+}
+
+// WithServerName sets the name used for SNI and to verify the server certificate
+func WithServerName(name string) ClientOption {
+	return func(c *Client) error {
+		c.tls().ServerName = name
+		return nil
+	}
+}
+
+// WithTLSReload loads the client certificate, key and CA from files and checks them
+// every interval, reloading them on change without rebuilding the client.
+// Failed reloads are logged and keep the previous certificates. Stop watching with Close
+func WithTLSReload(certFile, keyFile, caFile string, interval time.Duration) ClientOption {
+	return func(c *Client) error {
+		w := &certWatcher{certFile: certFile, keyFile: keyFile, caFile: caFile, interval: interval, stop: make(chan struct{})}
+		if _, err := w.reload(); err != nil {
+			return err
+		}
+		c.tls().GetClientCertificate = w.clientCertificate
+		c.tlsRoots = w.rootCAs
+		// Started by newClient once the client is fully built
+		c.watchers = append(c.watchers, w)
+		return nil
+	}
+}
+
+// Close stops certificate watchers and health checks and closes idle connections
+func (c *Client) Close() error {
+	for _, w := range c.watchers {
+		w.close()
+	}
+	c.watchers = nil
+	if c.endpoints != nil {
+		c.endpoints.close()
+	}
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// tls returns the client's TLS configuration, creating it on first use
+func (c *Client) tls() *tls.Config {
+	if c.tlsConfig == nil {
+		c.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return c.tlsConfig
+}
+
+// finishTLS installs the custom verification needed by dynamic roots and SPKI pins
+func (c *Client) finishTLS() {
+	if c.tlsConfig == nil || (c.tlsRoots == nil && len(c.spkiPins) == 0) {
+		return
+	}
+	if c.tlsRoots != nil {
+		// The chain is verified in VerifyConnection against the current pool instead
+		c.tlsConfig.InsecureSkipVerify = true
+	}
+	// crypto/tls leaves ServerName empty for IP hosts; dialTLS verifies those against
+	// the dialed address, anything else without a name is rejected
+	c.tlsConfig.VerifyConnection = c.verifyConnection("")
+}
+
+// verifyConnection returns a VerifyConnection callback checking the chain against the
+// dynamic roots and the pins, using name or else the handshake's server name
+func (c *Client) verifyConnection(name string) func(tls.ConnectionState) error {
+	roots, pins := c.tlsRoots, c.spkiPins
+	return func(cs tls.ConnectionState) error {
+		chains := cs.VerifiedChains
+		if roots != nil {
+			serverName := name
+			if serverName == "" {
+				serverName = cs.ServerName
+			}
+			if serverName == "" {
+				return errors.New("cannot verify server certificate without a server name")
+			}
+			var err error
+			if chains, err = verifyChain(cs, roots(), serverName); err != nil {
+				return err
+			}
+		}
+		if len(pins) > 0 {
+			return checkPins(chains, pins)
+		}
+		return nil
+	}
+}
+
+// dialTLS returns a DialTLSContext func that verifies dynamic roots against the dialed
+// host, or the configured ServerName, on a per-connection copy of the TLS config
+func (c *Client) dialTLS(base *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := base.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := base.TLSClientConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = host
+		}
+		cfg.VerifyConnection = c.verifyConnection(cfg.ServerName)
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// verifyChain verifies the server's certificate chain and name against roots
+func verifyChain(cs tls.ConnectionState, roots *x509.CertPool, name string) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("server presented no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	return cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       name,
+	})
+}
+
+// checkPins reports ErrPinMismatch unless a certificate in a verified chain has a pinned
+// SPKI hash. Unverified certificates the server appended are never considered
+func checkPins(chains [][]*x509.Certificate, pins []string) error {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			hash := base64.StdEncoding.EncodeToString(sum[:])
+			for _, pin := range pins {
+				if hash == pin {
+					return nil
+				}
+			}
+		}
+	}
+	return ErrPinMismatch
+}
+
+// certWatcher keeps the latest client certificate and CA pool loaded from files
+type certWatcher struct {
+	certFile, keyFile, caFile string
+	interval                  time.Duration
+	stop                      chan struct{}
+	once                      sync.Once
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// clientCertificate returns the current certificate for GetClientCertificate
+func (w *certWatcher) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cert, nil
+}
+
+// rootCAs returns the current CA pool
+func (w *certWatcher) rootCAs() *x509.CertPool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.pool
+}
+
+// reload loads the files if any of them changed, reporting whether it did
+func (w *certWatcher) reload() (bool, error) {
+	latest, err := latestModTime(w.certFile, w.keyFile, w.caFile)
+	if err != nil {
+		return false, err
+	}
+	w.mu.RLock()
+	unchanged := latest.Equal(w.modTime)
+	w.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	tlsConfig, err := loadTLSConfig(w.certFile, w.keyFile, w.caFile)
+	if err != nil {
+		return false, err
+	}
+	w.mu.Lock()
+	w.cert = &tlsConfig.Certificates[0]
+	w.pool = tlsConfig.RootCAs
+	w.modTime = latest
+	w.mu.Unlock()
+	return true, nil
+}
+
+// watch polls the files until close is called
+func (w *certWatcher) watch(c *Client) {
+	interval := w.interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			reloaded, err := w.reload()
+			switch {
+			case err != nil:
+				c.logger.Error("failed to reload TLS certificates", "cert", w.certFile, "error", err)
+			case reloaded:
+				c.logger.Info("reloaded TLS certificates", "cert", w.certFile)
+				// Existing connections keep the old certificate, new ones pick up the reloaded one
+				c.httpClient.CloseIdleConnections()
+			}
+		}
+	}
+}
+
+// close stops the watcher
+func (w *certWatcher) close() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// latestModTime returns the most recent modification time of the files
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
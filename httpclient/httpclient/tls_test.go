@@ -0,0 +1,162 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert issues a certificate for the given DNS names and IPs, signed by parent,
+// or a self-signed CA when parent is nil
+func newTestCert(t *testing.T, parent *testCert, dnsNames []string, ips []net.IP) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// pin returns the SPKI pin of the certificate
+func (c *testCert) pin() string {
+	sum := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// pem returns the certificate PEM-encoded
+func (c *testCert) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+// newTLSServer starts a server presenting leaf followed by extra certificates
+func newTLSServer(t *testing.T, leaf *testCert, extra ...*testCert) *httptest.Server {
+	t.Helper()
+	chain := tls.Certificate{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key}
+	for _, c := range extra {
+		chain.Certificate = append(chain.Certificate, c.cert.Raw)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{chain}}
+	// Rejected handshakes are expected and would only add noise
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+var localhostIP = []net.IP{net.ParseIP("127.0.0.1")}
+
+func TestRootCAsFuncVerifiesIPHost(t *testing.T) {
+	ca := newTestCert(t, nil, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	tests := []struct {
+		name    string
+		leaf    *testCert
+		wantErr bool
+	}{
+		{"matching IP SAN", newTestCert(t, ca, nil, localhostIP), false},
+		{"other name only", newTestCert(t, ca, []string{"other.test"}, nil), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTLSServer(t, tt.leaf)
+			c, err := NewClient(WithRetry(0, 0), WithRootCAsFunc(func() *x509.CertPool { return pool }))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			resp, err := c.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSPKIPinsIgnoreUnverifiedCertificates(t *testing.T) {
+	ca := newTestCert(t, nil, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	real := newTestCert(t, ca, nil, localhostIP)
+	evil := newTestCert(t, ca, nil, localhostIP)
+
+	tests := []struct {
+		name   string
+		option ClientOption
+	}{
+		{"static roots", WithTLSPEM(nil, nil, ca.pem())},
+		{"roots callback", WithRootCAsFunc(func() *x509.CertPool { return pool })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(WithRetry(0, 0), tt.option, WithSPKIPins(real.pin()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			// The real certificate appended after another trusted leaf must not satisfy the pin
+			_, err = c.Get(newTLSServer(t, evil, real).URL)
+			if !errors.Is(err, ErrPinMismatch) {
+				t.Errorf("appended pinned certificate: err = %v, want %v", err, ErrPinMismatch)
+			}
+
+			resp, err := c.Get(newTLSServer(t, real).URL)
+			if err != nil {
+				t.Fatalf("pinned leaf: %v", err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
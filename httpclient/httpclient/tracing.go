@@ -0,0 +1,208 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Attribute is a key/value pair attached to spans and events
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr creates an Attribute
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanContext identifies a span for W3C trace context propagation
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats the span context as a W3C traceparent header value
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// Span is the subset of a tracing span used by the client, easy to back with OpenTelemetry
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	SpanContext() SpanContext
+	End()
+}
+
+// Tracer starts spans; a span started from ctx becomes a child of any span already in it
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// WithTracer sets the tracer used to create a span for every request
+func WithTracer(tracer Tracer) ClientOption {
+	return func(c *Client) error {
+		if tracer == nil {
+			tracer = NoopTracer{}
+		}
+		c.tracer = tracer
+		return nil
+	}
+}
+
+// NoopTracer creates spans that record nothing and inject no traceparent header
+type NoopTracer struct{}
+
+// Start returns ctx unchanged and a no-op span
+func (NoopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// noopSpan discards everything
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute)    {}
+func (noopSpan) AddEvent(string, ...Attribute) {}
+func (noopSpan) RecordError(error)             {}
+func (noopSpan) SpanContext() SpanContext      { return SpanContext{} }
+func (noopSpan) End()                          {}
+
+// RecordingTracer keeps finished spans in memory, intended for tests
+type RecordingTracer struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span captured by RecordingTracer
+type RecordedSpan struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext
+	Attributes map[string]any
+	Events     []SpanEvent
+	Errors     []error
+	StartTime  time.Time
+	EndTime    time.Time
+
+	mu     sync.Mutex
+	tracer *RecordingTracer
+}
+
+// SpanEvent is an event added to a RecordedSpan
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// recordedSpanKey is the context key for the active RecordedSpan
+type recordedSpanKey struct{}
+
+// Start creates a span, as a child of the RecordedSpan in ctx if there is one
+func (t *RecordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &RecordedSpan{Name: name, Attributes: make(map[string]any), StartTime: time.Now(), tracer: t}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*RecordedSpan); ok {
+		s.Parent = parent.Context
+		s.Context.TraceID = parent.Context.TraceID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+	}
+	rand.Read(s.Context.SpanID[:])
+	s.Context.Sampled = true
+	return context.WithValue(ctx, recordedSpanKey{}, s), s
+}
+
+// Spans returns the spans that have ended so far
+func (t *RecordingTracer) Spans() []*RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*RecordedSpan(nil), t.spans...)
+}
+
+// SetAttributes stores attrs on the span
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		s.Attributes[a.Key] = a.Value
+	}
+}
+
+// AddEvent appends a timestamped event
+func (s *RecordedSpan) AddEvent(name string, attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := SpanEvent{Name: name, Time: time.Now(), Attributes: make(map[string]any, len(attrs))}
+	for _, a := range attrs {
+		e.Attributes[a.Key] = a.Value
+	}
+	s.Events = append(s.Events, e)
+}
+
+// RecordError stores err on the span
+func (s *RecordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Errors = append(s.Errors, err)
+}
+
+// SpanContext returns the span's identifiers
+func (s *RecordedSpan) SpanContext() SpanContext {
+	return s.Context
+}
+
+// End finishes the span and hands it to the tracer
+func (s *RecordedSpan) End() {
+	s.mu.Lock()
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.mu.Unlock()
+}
+
+// requestAttributes returns the standard HTTP client span attributes for req
+func requestAttributes(req *http.Request) []Attribute {
+	attrs := []Attribute{
+		Attr("http.request.method", req.Method),
+		Attr("url.full", RedactURL(req.URL)),
+		Attr("server.address", req.URL.Hostname()),
+	}
+	if port := req.URL.Port(); port != "" {
+		attrs = append(attrs, Attr("server.port", port))
+	}
+	return attrs
+}
+
+// retryAttributes describes a failed attempt that is about to be retried
+func retryAttributes(attempt int, delay time.Duration, resp *http.Response, err error) []Attribute {
+	attrs := []Attribute{
+		Attr("http.request.resend_count", attempt+1),
+		Attr("retry.delay", delay.String()),
+	}
+	if resp != nil {
+		attrs = append(attrs, Attr("http.response.status_code", resp.StatusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, Attr("error.type", fmt.Sprintf("%T", err)))
+	}
+	return attrs
+}
@@ -0,0 +1,216 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolveURL joins ref onto base. Relative references are appended to the base path
+// with exactly one slash between them, dot segments are removed as by ResolveReference,
+// and their query is merged with the base query; absolute URLs are used as they are
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL: %w", err)
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", ref, err)
+	}
+	if r.IsAbs() || r.Host != "" {
+		return b.ResolveReference(r).String(), nil
+	}
+
+	joined := *b
+	if refPath := r.EscapedPath(); refPath != "" {
+		path := cleanPath(strings.TrimRight(b.EscapedPath(), "/") + "/" + strings.TrimLeft(refPath, "/"))
+		if joined.Path, err = url.PathUnescape(path); err != nil {
+			return "", fmt.Errorf("invalid URL %q: %w", ref, err)
+		}
+		joined.RawPath = path
+	}
+	switch {
+	case b.RawQuery == "":
+		joined.RawQuery = r.RawQuery
+	case r.RawQuery != "":
+		joined.RawQuery = b.RawQuery + "&" + r.RawQuery
+	}
+	joined.Fragment, joined.RawFragment = r.Fragment, r.RawFragment
+	return joined.String(), nil
+}
+
+// cleanPath removes dot segments from an escaped path, keeping a trailing slash
+func cleanPath(p string) string {
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// expandPath replaces {name} placeholders in the URL path with escaped values.
+// Every placeholder in the template must have a value; values may contain braces
+func expandPath(u *url.URL, params map[string]string) error {
+	path, escaped := u.Path, u.EscapedPath()
+	for rest := path; ; {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			break
+		}
+		name := rest[start+1 : start+end]
+		if _, ok := params[name]; !ok {
+			return fmt.Errorf("missing path parameter %q", name)
+		}
+		rest = rest[start+end+1:]
+	}
+	// Replace in a single pass so inserted values are never expanded again
+	var raw, esc []string
+	for name, value := range params {
+		raw = append(raw, "{"+name+"}", value)
+		esc = append(esc, "%7B"+url.PathEscape(name)+"%7D", url.PathEscape(value))
+	}
+	u.Path = strings.NewReplacer(raw...).Replace(path)
+	u.RawPath = strings.NewReplacer(esc...).Replace(escaped)
+	return nil
+}
+
+// encodeQuery adds the fields of v to q. v may be url.Values, map[string]string or a
+// struct (or pointer to one) whose fields are named by `url:"name,omitempty"` tags
+func encodeQuery(q url.Values, v any) error {
+	switch values := v.(type) {
+	case url.Values:
+		for k, vs := range values {
+			for _, s := range vs {
+				q.Add(k, s)
+			}
+		}
+		return nil
+	case map[string]string:
+		for k, s := range values {
+			q.Add(k, s)
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot encode %T as a query, want a struct", v)
+	}
+	return encodeStruct(q, rv)
+}
+
+// encodeStruct adds the exported fields of a struct value to q
+func encodeStruct(q url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		omitempty := strings.Contains(opts, "omitempty")
+		fv := rv.Field(i)
+
+		if field.Anonymous && name == "" && indirect(fv).Kind() == reflect.Struct && !isTime(indirect(fv)) {
+			if fv = indirect(fv); fv.IsValid() {
+				if err := encodeStruct(q, fv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if omitempty && fv.IsZero() {
+			continue
+		}
+
+		fv = indirect(fv)
+		if !fv.IsValid() {
+			continue
+		}
+		if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array) && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formatValue(indirect(fv.Index(j)))
+				if err != nil {
+					return fmt.Errorf("query field %s: %w", field.Name, err)
+				}
+				q.Add(name, s)
+			}
+			continue
+		}
+		s, err := formatValue(fv)
+		if err != nil {
+			return fmt.Errorf("query field %s: %w", field.Name, err)
+		}
+		q.Add(name, s)
+	}
+	return nil
+}
+
+// formatValue renders a scalar query value
+func formatValue(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "", nil
+	}
+	if isTime(v) {
+		return v.Interface().(time.Time).Format(time.RFC3339), nil
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String(), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", errors.New("unsupported type " + v.Type().String())
+}
+
+// indirect follows pointers, returning the zero Value for a nil pointer
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// isTime reports whether v holds a time.Time
+func isTime(v reflect.Value) bool {
+	return v.IsValid() && v.Type() == reflect.TypeOf(time.Time{})
+}
@@ -0,0 +1,55 @@
+package httpclient
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		base, ref, want string
+	}{
+		{"http://h/v1", "x", "http://h/v1/x"},
+		{"http://h/v1/", "/x/", "http://h/v1/x/"},
+		{"http://h/v1", "../x", "http://h/x"},
+		{"http://h/v1/a", "./b/../c", "http://h/v1/a/c"},
+		{"http://h/v1", "a%2Fb", "http://h/v1/a%2Fb"},
+		{"http://h/v1?k=1", "x?p=2#f", "http://h/v1/x?k=1&p=2#f"},
+		{"http://h/v1", "http://o/../y", "http://o/y"},
+	}
+	for _, tt := range tests {
+		if got, err := resolveURL(tt.base, tt.ref); err != nil || got != tt.want {
+			t.Errorf("resolveURL(%q, %q) = %q, %v, want %q", tt.base, tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	tests := []struct {
+		template string
+		params   map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{"http://h/users/{id}", map[string]string{"id": "42"}, "http://h/users/42", false},
+		{"http://h/users/{id}", map[string]string{"id": "a/b c"}, "http://h/users/a%2Fb%20c", false},
+		{"http://h/users/{id}/{tab}", map[string]string{"id": "a{b}", "b": "x", "tab": "{id}"}, "http://h/users/a%7Bb%7D/%7Bid%7D", false},
+		{"http://h/users/{id}", map[string]string{"other": "1"}, "", true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = expandPath(u, tt.params)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("expandPath(%q) succeeded, want an error", tt.template)
+			}
+			continue
+		}
+		if err != nil || u.String() != tt.want {
+			t.Errorf("expandPath(%q, %v) = %q, %v, want %q", tt.template, tt.params, u, err, tt.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"http-client-example/httpclient"
@@ -19,8 +20,8 @@ func main() {
 	}
 
 	// Create client with various options
-	client := httpclient.New(
-		httpclient.WithTimeout(10*time.Second),
+	opts := []httpclient.ClientOption{
+		httpclient.WithTimeout(10 * time.Second),
 		httpclient.WithRetry(3, time.Second),
 		httpclient.WithTransport(transport),
 		httpclient.WithBaseURL("https://jsonplaceholder.typicode.com"),
@@ -28,7 +29,16 @@ func main() {
 			"User-Agent":   "CustomHTTPClient/1.0",
 			"Content-Type": "application/json",
 		}),
-	)
+	}
+
+	// Replay from a cassette when set, recording it on the first run
+	if cassette := os.Getenv("HTTPCLIENT_CASSETTE"); cassette != "" {
+		opts = append(opts, httpclient.WithRecorder(cassette, httpclient.ModeReplayOrRecord))
+	}
+	client, err := httpclient.NewClient(opts...)
+	if err != nil {
+		log.Fatalf("Invalid client configuration: %v", err)
+	}
 
 	// Context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -62,7 +72,7 @@ func main() {
 
 	// Example with TLS (commented out as it needs certificates)
 	/*
-		clientWithTLS := httpclient.New(
+		clientWithTLS, err := httpclient.NewClient(
 			httpclient.WithTimeout(10*time.Second),
 			httpclient.WithTLSConfig(
 				"path/to/cert.pem",